@@ -0,0 +1,168 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/MorganPeterson/octanepoints/internal/database"
+)
+
+var carsGroup = &group{
+	name:    "cars",
+	summary: "Manage the cars in the database and their categories.",
+	commands: []*command{
+		{
+			name:    "list",
+			summary: "list the cars in the database",
+			setup:   listCarsCommand,
+		},
+		{
+			name:    "add",
+			args:    "<brand> <model>",
+			summary: "add a car that isn't in cars.json",
+			setup:   addCarCommand,
+		},
+		{
+			name:    "set-category",
+			args:    "<rsf-id|car> <category>",
+			summary: "move a car to another category",
+			setup: func(fs *flag.FlagSet) func(a *app, args []string) error {
+				return func(a *app, args []string) error {
+					if len(args) != 2 {
+						return fail(exitUsage, "cars set-category takes a car and a category")
+					}
+					return doSetCarCategory(a, args[0], args[1])
+				}
+			},
+		},
+		{
+			name:    "sync",
+			summary: "add the cars of cars.json that aren't in the database yet",
+			setup:   syncCarsCommand,
+		},
+	},
+}
+
+func listCarsCommand(fs *flag.FlagSet) func(a *app, args []string) error {
+	category := fs.String("category", "", "only list the cars of this category")
+	unclassified := fs.Bool("unclassified", false, "only list the cars registered from results that still need a category")
+
+	return func(a *app, args []string) error {
+		if len(args) > 0 {
+			return fail(exitUsage, "cars list takes no arguments")
+		}
+		if *unclassified {
+			*category = database.UnclassifiedCategory
+		}
+
+		store, err := a.Store()
+		if err != nil {
+			return err
+		}
+		cars, err := database.ListCars(store, *category)
+		if err != nil {
+			return fail(exitDatabase, "failed to list cars: %w", err)
+		}
+		printCars(cars)
+		return nil
+	}
+}
+
+func printCars(cars []database.Cars) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RSF ID\tCar\tCategory")
+	for _, c := range cars {
+		fmt.Fprintf(tw, "%d\t%s %s\t%s\n", c.RSFID, c.Brand, c.Model, c.Category)
+	}
+	tw.Flush()
+}
+
+func addCarCommand(fs *flag.FlagSet) func(a *app, args []string) error {
+	category := fs.String("category", database.UnclassifiedCategory, "category of the car")
+	rsfId := fs.Int64("rsf-id", 0, "RSF ID of the car; a local ID is used when not given")
+
+	return func(a *app, args []string) error {
+		if len(args) != 2 {
+			return fail(exitUsage, "cars add takes a brand and a model")
+		}
+
+		store, err := a.Store()
+		if err != nil {
+			return err
+		}
+		car, err := database.AddCar(store, database.Cars{
+			RSFID:    *rsfId,
+			Brand:    args[0],
+			Model:    args[1],
+			Category: *category,
+		})
+		if err != nil {
+			return fail(exitDatabase, "failed to add car: %w", err)
+		}
+		fmt.Printf("Added %s %s (RSF ID %d) to %s.\n", car.Brand, car.Model, car.RSFID, car.Category)
+		return nil
+	}
+}
+
+// doSetCarCategory moves a car, given by RSF ID or name, to another category.
+func doSetCarCategory(a *app, car, category string) error {
+	store, err := a.Store()
+	if err != nil {
+		return err
+	}
+
+	c, err := database.SetCarCategory(store, car, category)
+	if err != nil {
+		return fail(exitDatabase, "failed to set car category: %w", err)
+	}
+	fmt.Printf("%s %s is now in %s.\n", c.Brand, c.Model, c.Category)
+	return nil
+}
+
+func syncCarsCommand(fs *flag.FlagSet) func(a *app, args []string) error {
+	file := fs.String("file", "cars.json", "cars file to read")
+
+	return func(a *app, args []string) error {
+		if len(args) > 0 {
+			return fail(exitUsage, "cars sync takes no arguments")
+		}
+
+		store, err := a.Store()
+		if err != nil {
+			return err
+		}
+		res, err := database.SyncCars(store, *file)
+		if err != nil {
+			return fail(exitDatabase, "failed to sync cars: %w", err)
+		}
+
+		for _, c := range res.Added {
+			fmt.Printf("added    %s %s (%s)\n", c.Brand, c.Model, c.Category)
+		}
+		for _, c := range res.Adopted {
+			fmt.Printf("updated  %s %s (%s), was registered from results\n", c.Brand, c.Model, c.Category)
+		}
+		for _, c := range res.Skipped {
+			fmt.Fprintf(os.Stderr, "skipped  %s %s (RSF ID %d), its name is taken by another car\n", c.Brand, c.Model, c.RSFID)
+		}
+		fmt.Printf("Added %d, updated %d, skipped %d cars.\n", len(res.Added), len(res.Adopted), len(res.Skipped))
+		return nil
+	}
+}
+
+// warnUnclassified points at the cars registered from results that still
+// need a category.
+func warnUnclassified(a *app) {
+	store, err := a.Store()
+	if err != nil {
+		return
+	}
+	cars, err := database.ListCars(store, database.UnclassifiedCategory)
+	if err != nil || len(cars) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%d cars are %s, see 'octanepoints cars list --unclassified'.\n",
+		len(cars), database.UnclassifiedCategory)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/MorganPeterson/octanepoints/internal/configuration"
+	"github.com/MorganPeterson/octanepoints/internal/database"
+)
+
+var classesGroup = &group{
+	name:    "classes",
+	summary: "Inspect the classes and their members.",
+	commands: []*command{
+		{
+			name:    "roster",
+			summary: "list the class rosters and the drivers they matched",
+			setup:   rosterCommand,
+		},
+		{
+			name:    "explain",
+			args:    "[rally-id...]",
+			summary: "show which class each car, or each entrant of the rallies, is in and why",
+			setup:   explainCommand,
+		},
+	},
+}
+
+func rosterCommand(fs *flag.FlagSet) func(a *app, args []string) error {
+	unmatched := fs.Bool("unmatched", false, "only list roster names that match no results yet")
+
+	return func(a *app, args []string) error {
+		if len(args) > 0 {
+			return fail(exitUsage, "classes roster takes no arguments")
+		}
+
+		store, err := a.Store()
+		if err != nil {
+			return err
+		}
+		entries, err := database.GetClassRosters(store)
+		if err != nil {
+			return fail(exitDatabase, "failed to list class rosters: %w", err)
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "Class\tRoster\tRallies\tDriver")
+		for _, e := range entries {
+			if *unmatched && e.Matched() {
+				continue
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.Class, rosterName(e), rallyRange(e.From, e.To), rosterDriver(e))
+		}
+		tw.Flush()
+		return nil
+	}
+}
+
+func explainCommand(fs *flag.FlagSet) func(a *app, args []string) error {
+	return func(a *app, args []string) error {
+		ids, err := parseRallyIds(args)
+		if err != nil {
+			return fail(exitUsage, "%w", err)
+		}
+		store, err := a.Store()
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		defer tw.Flush()
+
+		if len(ids) == 0 {
+			cars, err := database.ExplainCars(store)
+			if err != nil {
+				return fail(exitDatabase, "failed to resolve car classes: %w", err)
+			}
+			fmt.Fprintln(tw, "RSF ID\tCar\tCategory\tClass\tRallies\tReason")
+			for _, cc := range cars {
+				fmt.Fprintf(tw, "%d\t%s %s\t%s\t%s\t%s\t%s\n", cc.Car.RSFID, cc.Car.Brand, cc.Car.Model,
+					cc.Car.Category, className(cc.Class), rallyRange(cc.From, cc.To), cc.Reason)
+			}
+			return nil
+		}
+
+		fmt.Fprintln(tw, "Rally\tDriver\tCar\tClass\tReason")
+		for _, id := range ids {
+			entrants, err := database.ExplainEntrants(store, id)
+			if err != nil {
+				return fail(exitDatabase, "failed to resolve classes of rally %d: %w", id, err)
+			}
+			for _, e := range entrants {
+				fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", id, e.UserName, e.Car, className(e.Class), e.Reason)
+			}
+		}
+		return nil
+	}
+}
+
+// className is a class name for listings, "-" for none.
+func className(name string) string {
+	if name == "" {
+		return "-"
+	}
+	return name
+}
+
+// rosterName is a roster entry as written in the configuration.
+func rosterName(e database.RosterEntry) string {
+	if e.UserId != 0 {
+		return fmt.Sprintf("#%d", e.UserId)
+	}
+	return e.UserName
+}
+
+// rallyRange is the range of rallies a class membership is for.
+func rallyRange(from, to int64) string {
+	switch {
+	case from == 0 && to == 0:
+		return "all"
+	case to == 0:
+		return fmt.Sprintf("from %d", from)
+	case from == 0:
+		return fmt.Sprintf("until %d", to)
+	}
+	return fmt.Sprintf("%d to %d", from, to)
+}
+
+// rosterDriver is the driver a roster entry matched.
+func rosterDriver(e database.RosterEntry) string {
+	if !e.Matched() {
+		return "no results yet"
+	}
+	return fmt.Sprintf("%s (#%d)", e.Driver.Name, e.Driver.UserId)
+}
+
+// warnUnmatchedRoster points at the class roster names that match no
+// results, which usually are typos or drivers yet to start a rally.
+func warnUnmatchedRoster(a *app) {
+	if a.config.General.ClassesType != configuration.ClassesDriver {
+		return
+	}
+	store, err := a.Store()
+	if err != nil {
+		return
+	}
+	entries, err := database.GetClassRosters(store)
+	if err != nil {
+		return
+	}
+
+	n := 0
+	for _, e := range entries {
+		if !e.Matched() {
+			n++
+		}
+	}
+	if n > 0 {
+		fmt.Fprintf(os.Stderr, "%d class roster names match no results yet, see 'octanepoints classes roster --unmatched'.\n", n)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// command is a single subcommand, e.g. "rally create".
+type command struct {
+	name    string // subcommand name
+	args    string // argument synopsis shown in help, e.g. "<rally-id>..."
+	summary string // one line description
+
+	// setup defines the command's flags on fs and returns the function that
+	// runs the command with the remaining positional arguments.
+	setup func(fs *flag.FlagSet) func(a *app, args []string) error
+}
+
+// group collects the subcommands of a top level command, e.g. "rally".
+type group struct {
+	name     string
+	summary  string
+	commands []*command
+}
+
+// groups lists every command the CLI knows about, in help order.
+var groups = []*group{
+	rallyGroup,
+	reportGroup,
+	seasonGroup,
+	carsGroup,
+	driversGroup,
+	classesGroup,
+}
+
+// dispatch runs the command named by the positional arguments left after the
+// global flags were parsed.
+func dispatch(a *app, global *flag.FlagSet) error {
+	args := global.Args()
+	if len(args) == 0 {
+		printUsage(global)
+		return fail(exitUsage, "no command given")
+	}
+
+	if args[0] == "help" {
+		return help(global, args[1:])
+	}
+
+	g := findGroup(args[0])
+	if g == nil {
+		printUsage(global)
+		return fail(exitUsage, "unknown command %q", args[0])
+	}
+	if len(args) < 2 {
+		printGroupUsage(global, g)
+		return fail(exitUsage, "%s: no subcommand given", g.name)
+	}
+
+	c := g.find(args[1])
+	if c == nil {
+		printGroupUsage(global, g)
+		return fail(exitUsage, "%s: unknown subcommand %q", g.name, args[1])
+	}
+
+	fs, runCmd := c.flagSet(g)
+	if err := fs.Parse(args[2:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return fail(exitUsage, "%s %s: %w", g.name, c.name, err)
+	}
+
+	return runCmd(a, fs.Args())
+}
+
+// help prints help for the whole program, a group or a single command.
+func help(global *flag.FlagSet, args []string) error {
+	if len(args) == 0 {
+		printUsage(global)
+		return nil
+	}
+
+	g := findGroup(args[0])
+	if g == nil {
+		return fail(exitUsage, "unknown command %q", args[0])
+	}
+	if len(args) == 1 {
+		printGroupUsage(global, g)
+		return nil
+	}
+
+	c := g.find(args[1])
+	if c == nil {
+		return fail(exitUsage, "%s: unknown subcommand %q", g.name, args[1])
+	}
+	fs, _ := c.flagSet(g)
+	fs.Usage()
+	return nil
+}
+
+func findGroup(name string) *group {
+	for _, g := range groups {
+		if g.name == name {
+			return g
+		}
+	}
+	return nil
+}
+
+func (g *group) find(name string) *command {
+	for _, c := range g.commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// flagSet builds the flag set for a command, including its usage text.
+func (c *command) flagSet(g *group) (*flag.FlagSet, func(a *app, args []string) error) {
+	fs := flag.NewFlagSet(g.name+" "+c.name, flag.ContinueOnError)
+	runCmd := c.setup(fs)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: octanepoints [global flags] %s %s", g.name, c.name)
+		if hasFlags(fs) {
+			fmt.Fprint(out, " [flags]")
+		}
+		if c.args != "" {
+			fmt.Fprintf(out, " %s", c.args)
+		}
+		fmt.Fprintf(out, "\n\n%s\n", c.summary)
+		if hasFlags(fs) {
+			fmt.Fprintln(out, "\nFlags:")
+			fs.PrintDefaults()
+		}
+	}
+	return fs, runCmd
+}
+
+func hasFlags(fs *flag.FlagSet) bool {
+	n := 0
+	fs.VisitAll(func(*flag.Flag) { n++ })
+	return n > 0
+}
+
+func printUsage(global *flag.FlagSet) {
+	out := global.Output()
+	fmt.Fprintln(out, "Usage: octanepoints [global flags] <command> <subcommand> [flags] [args]")
+	fmt.Fprintln(out, "\nCommands:")
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, g := range groups {
+		for _, c := range g.commands {
+			fmt.Fprintf(tw, "  %s %s %s\t%s\n", g.name, c.name, c.args, c.summary)
+		}
+	}
+	tw.Flush()
+	fmt.Fprintln(out, "\nGlobal flags:")
+	global.PrintDefaults()
+	fmt.Fprintln(out, "\nRun 'octanepoints help <command> <subcommand>' for more information.")
+}
+
+func printGroupUsage(global *flag.FlagSet, g *group) {
+	out := global.Output()
+	fmt.Fprintf(out, "Usage: octanepoints [global flags] %s <subcommand> [flags] [args]\n\n%s\n\nSubcommands:\n", g.name, g.summary)
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, c := range g.commands {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", c.name, c.args, c.summary)
+	}
+	tw.Flush()
+}
+
+// rallyList is a flag.Value collecting rally IDs. It may be repeated and
+// accepts comma separated lists, e.g. --rally 15234,15240 --rally 15250.
+type rallyList []int64
+
+func (r *rallyList) String() string {
+	parts := make([]string, len(*r))
+	for i, id := range *r {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (r *rallyList) Set(val string) error {
+	ids, err := parseRallyIds(strings.Split(val, ","))
+	if err != nil {
+		return err
+	}
+	*r = append(*r, ids...)
+	return nil
+}
+
+// maxRallyRange is the most rallies a range like 15234-15240 may cover, to
+// catch typos before they turn into thousands of downloads.
+const maxRallyRange = 500
+
+// parseRallyIds converts rally ID arguments into numbers. An argument may be
+// a range of IDs, e.g. 15234-15240.
+func parseRallyIds(args []string) ([]int64, error) {
+	ids := make([]int64, 0, len(args))
+	for _, arg := range args {
+		arg = strings.TrimSpace(arg)
+		if arg == "" {
+			continue
+		}
+		if from, to, ok := strings.Cut(arg, "-"); ok {
+			first, err1 := strconv.ParseInt(from, 10, 64)
+			last, err2 := strconv.ParseInt(to, 10, 64)
+			if err1 != nil || err2 != nil || first <= 0 || last < first {
+				return nil, fmt.Errorf("invalid rally ID range %q", arg)
+			}
+			if last-first >= maxRallyRange {
+				return nil, fmt.Errorf("rally ID range %q covers more than %d rallies", arg, maxRallyRange)
+			}
+			for id := first; id <= last; id++ {
+				ids = append(ids, id)
+			}
+			continue
+		}
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid rally ID %q", arg)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// rallyArgs merges rally IDs given with --rally and as positional arguments,
+// drops duplicates and requires at least one.
+func rallyArgs(flagged rallyList, args []string) ([]int64, error) {
+	parsed, err := parseRallyIds(args)
+	if err != nil {
+		return nil, fail(exitUsage, "%w", err)
+	}
+
+	seen := map[int64]struct{}{}
+	ids := make([]int64, 0, len(flagged)+len(parsed))
+	for _, id := range append(append([]int64(nil), flagged...), parsed...) {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		ids = append(ids, id)
+	}
+
+	if len(ids) == 0 {
+		return nil, fail(exitUsage, "at least one rally ID is required")
+	}
+	return ids, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/MorganPeterson/octanepoints/internal/database"
+)
+
+var driversGroup = &group{
+	name:    "drivers",
+	summary: "Manage the drivers in the database and the names they drove under.",
+	commands: []*command{
+		{
+			name:    "list",
+			summary: "list the drivers with their RSF user ID and other names",
+			setup: func(fs *flag.FlagSet) func(a *app, args []string) error {
+				return func(a *app, args []string) error {
+					if len(args) > 0 {
+						return fail(exitUsage, "drivers list takes no arguments")
+					}
+					return doListDrivers(a)
+				}
+			},
+		},
+		{
+			name:    "merge",
+			args:    "<old-name> <new-name>",
+			summary: "count the results of one driver for another, e.g. after a new account",
+			setup: func(fs *flag.FlagSet) func(a *app, args []string) error {
+				return func(a *app, args []string) error {
+					if len(args) != 2 {
+						return fail(exitUsage, "drivers merge takes an old and a new driver name")
+					}
+					return doMergeDrivers(a, args[0], args[1])
+				}
+			},
+		},
+	},
+}
+
+// doListDrivers prints every driver with the other names and accounts they
+// drove under.
+func doListDrivers(a *app) error {
+	store, err := a.Store()
+	if err != nil {
+		return err
+	}
+
+	drivers, err := database.ListDrivers(store)
+	if err != nil {
+		return fail(exitDatabase, "failed to list drivers: %w", err)
+	}
+	aliases, err := database.DriverAliases(store)
+	if err != nil {
+		return fail(exitDatabase, "failed to list drivers: %w", err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "User ID\tName\tNationality\tAlso known as")
+	for _, d := range drivers {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", d.UserId, d.Name, d.Nationality, strings.Join(aliases[d.ID], ", "))
+	}
+	tw.Flush()
+	return nil
+}
+
+// doMergeDrivers counts the results of the driver known as from for the
+// driver known as to.
+func doMergeDrivers(a *app, from, to string) error {
+	store, err := a.Store()
+	if err != nil {
+		return err
+	}
+
+	d, err := database.MergeDrivers(store, from, to)
+	if err != nil {
+		return fail(exitDatabase, "failed to merge drivers: %w", err)
+	}
+	fmt.Printf("Results of %s now count for %s (user ID %d).\n", from, d.Name, d.UserId)
+	return nil
+}
@@ -1,234 +1,178 @@
 package main
 
 import (
-	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 
 	"github.com/MorganPeterson/octanepoints/internal/configuration"
 	"github.com/MorganPeterson/octanepoints/internal/database"
-	"github.com/MorganPeterson/octanepoints/internal/grab"
-	"github.com/MorganPeterson/octanepoints/internal/reports"
 )
 
-const configPath string = "config.toml" // Path to the configuration file
-
-var (
-	createRally     = flag.Int64("create", 0, "put rally data in db with given ID number")
-	basicReport     = flag.Int64("report", 0, "export rally points report for a single rally to markdown file")
-	rallySummary    = flag.Bool("summary", false, "fetch driver point summaries for the championship so far")
-	driverSummaries = flag.Int64("driver", 0, "export driver report for a single rally to markdown file")
-	grabData        = flag.Int64("grab", 0, "grab raw rally data from RSF with given rally ID number")
-	classReport     = flag.Int64("class", 0, "export class points report for a single rally to markdown file")
-	allReports      = flag.Int64("all", 0, "run all commands for a single rally in one go")
+const defaultConfigPath string = "config.toml" // Path to the configuration file
+
+// Exit codes, one per class of failure, so scripts can tell what went wrong.
+const (
+	exitOK       = 0
+	exitFailure  = 1 // anything not covered below
+	exitUsage    = 2 // bad command line
+	exitConfig   = 3 // configuration could not be loaded or is invalid
+	exitDatabase = 4 // database could not be opened, read or written
+	exitDownload = 5 // rally data could not be downloaded
+	exitReport   = 6 // a report could not be generated
+	exitInvalid  = 7 // rally files hold values that don't parse
 )
 
-func main() {
-	flag.Parse()
-
-	var active []string
-	flag.Visit(func(f *flag.Flag) {
-		active = append(active, f.Name)
-	})
-
-	if len(active) == 0 || len(active) > 1 {
-		log.Fatalf("You must specify exactly one command to run. Active flags: %v", active)
-	}
-
-	// Load the configuration
-	config := configuration.MustLoad(configPath)
+// exitError attaches an exit code to an error.
+type exitError struct {
+	code int
+	err  error
+}
 
-	if err := createDirs(config); err != nil {
-		log.Fatalf("Failed to create directories: %v", err)
-	}
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
 
-	// get a single rally's data from the RSF rally page and download it
-	// This does not require the database to be set up or configuration to be
-	// loaded and so it is at the top of the main function.
-	if active[0] == "grab" && grabData != nil {
-		if err := grab.Grab(context.Background(), *grabData, config); err != nil {
-			log.Fatalf("Failed to grab rally data: %v", err)
-		}
-		log.Printf("Rally %d setup successfully.\n", *grabData)
-		return
-	}
+// fail builds an error carrying the exit code the process should end with.
+func fail(code int, format string, args ...any) error {
+	return &exitError{code: code, err: fmt.Errorf(format, args...)}
+}
 
-	dbFilePath := filepath.Join(
-		config.General.Directory,
-		config.Database.Directory,
-		config.Database.Name,
-	)
+// app holds the global options and the lazily loaded configuration and
+// database shared by all commands.
+type app struct {
+	configPath string
+	dbPath     string
+	format     string
+	out        string
 
-	// init database store
-	store, err := database.NewStore(dbFilePath)
-	if err != nil {
-		log.Fatalf("Failed to initialize database store: %v", err)
-	}
-	defer store.Close()
-
-	switch active[0] {
-	case "all":
-		doAllReports(store, config, allReports)
-	case "create":
-		doCreateRally(store, config, createRally)
-	case "report":
-		doReport(store, config, basicReport)
-	case "summary":
-		doSummary(store, config)
-	case "driver":
-		doDriver(store, config, driverSummaries)
-	case "class":
-		doClass(store, config, classReport)
-	default:
-		log.Fatalf("Unknown command: %s. Active flags: %v", active[0], active)
-	}
+	config *configuration.Config
+	store  *database.Store
 }
 
-func ensureDirs(dirs []string) error {
-	if len(dirs) == 0 {
-		return nil
-	}
-
-	// create the root directory
-	root := dirs[0]
-	if err := os.MkdirAll(root, 0755); err != nil {
-		return fmt.Errorf("failed to create directory %q: %w", root, err)
-	}
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
 
-	// create each subsequent as a subdirectory of root
-	for _, sub := range dirs[1:] {
-		path := filepath.Join(root, sub)
-		if err := os.MkdirAll(path, 0755); err != nil {
-			return fmt.Errorf("failed to create sub-directory %q: %w", path, err)
+// run parses the global flags, dispatches to the requested command and
+// returns the process exit code.
+func run(args []string) int {
+	a := &app{}
+
+	fs := flag.NewFlagSet("octanepoints", flag.ContinueOnError)
+	fs.StringVar(&a.configPath, "config", defaultConfigPath, "path to the configuration file")
+	fs.StringVar(&a.dbPath, "db", "", "path to the database file (overrides [database])")
+	fs.StringVar(&a.format, "format", "", "report format: markdown, csv or both (overrides report.format)")
+	fs.StringVar(&a.out, "out", "", "directory reports are written to (overrides report.directory)")
+	fs.Usage = func() { printUsage(fs) }
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
 		}
+		return exitUsage
 	}
-	return nil
-}
 
-func createDirs(config *configuration.Config) error {
-	baseDirs := []string{
-		config.General.Directory,
-		config.Download.Directory,
-		config.Database.Directory,
-		config.Report.Directory,
-		filepath.Join(config.Report.Directory, config.Report.MdDirectory),
-		filepath.Join(config.Report.Directory, config.Report.CsvDirectory),
-	}
+	err := dispatch(a, fs)
+	a.close()
 
-	err := ensureDirs(baseDirs)
-	if err != nil {
-		return fmt.Errorf("failed to ensure general directory exists: %v", err)
+	if err == nil || errors.Is(err, flag.ErrHelp) {
+		return exitOK
 	}
 
-	return nil
+	fmt.Fprintf(os.Stderr, "octanepoints: %v\n", err)
+	var ee *exitError
+	if errors.As(err, &ee) {
+		return ee.code
+	}
+	return exitFailure
 }
 
-// doAllReports Given a rally ID number, we run all reports in one go.
-// This is useful for generating all reports for a single rally in one command.
-func doAllReports(store *database.Store, config *configuration.Config, rallyId *int64) {
-	var rid int64
-	if rallyId == nil {
-		log.Fatal("Rally ID must be provided for all reports")
+// Config loads the configuration on first use, applies the global overrides
+// and makes sure all data directories exist.
+func (a *app) Config() (*configuration.Config, error) {
+	if a.config != nil {
+		return a.config, nil
 	}
 
-	rid = *rallyId
-
-	// If all reports are requested, we run the grab command first
-	if err := grab.Grab(context.Background(), rid, config); err != nil {
-		log.Fatalf("Failed to grab rally data for all reports: %v", err)
+	config, err := configuration.LoadFile(a.configPath)
+	if err != nil {
+		return nil, fail(exitConfig, "%w", err)
 	}
-	log.Printf("Rally %d downloaded successfully.\n", rid)
 
-	if err := database.CreateRally(rid, config, store); err != nil {
-		log.Fatalf("Failed to create rally: %v", err)
+	if a.dbPath != "" {
+		abs, err := filepath.Abs(a.dbPath)
+		if err != nil {
+			return nil, fail(exitUsage, "resolving --db: %w", err)
+		}
+		config.Database.Directory = filepath.Dir(abs)
+		config.Database.Name = filepath.Base(abs)
 	}
-	log.Printf("Rally %d created successfully.\n", rid)
 
-	if err := reports.ExportReport(rid, store, config); err != nil {
-		log.Fatalf("Failed to export %d_points_summary_report: %v", rid, err)
+	if a.format != "" {
+		if a.format != "markdown" && a.format != "csv" && a.format != "both" {
+			return nil, fail(exitUsage, "invalid --format %q: must be 'markdown', 'csv', or 'both'", a.format)
+		}
+		config.Report.Format = a.format
 	}
-	log.Printf("Report exported to %d_points_summary_report\n", rid)
 
-	if err := reports.ExportDriverSummaries(store, config); err != nil {
-		log.Fatalf("Failed to export drivers_summary: %v", err)
+	if a.out != "" {
+		abs, err := filepath.Abs(a.out)
+		if err != nil {
+			return nil, fail(exitUsage, "resolving --out: %w", err)
+		}
+		config.Report.Directory = abs
 	}
-	log.Println("Championship summary exported to drivers_summary")
 
-	if err := reports.DriverRallyReport(rid, store, config); err != nil {
-		log.Fatalf("Failed to export %d_driver_rally_summary: %v", rid, err)
+	if err := createDirs(config); err != nil {
+		return nil, fail(exitConfig, "failed to create directories: %w", err)
 	}
-	log.Printf("Driver rally summary exported to %d_driver_rally_summary\n", rid)
 
-	if err := reports.ExportClassReport(rid, store, config); err != nil {
-		log.Fatalf("Failed to export %d_class_summary: %v", rid, err)
-	}
-	log.Printf("Class report exported to %d_class_summary\n", rid)
+	a.config = config
+	return config, nil
 }
 
-// doCreateRally Given a rally ID number, we read the raw csv data for a rally from the
-// rallies/[rally_id] directory and put it into the database.
-func doCreateRally(store *database.Store, config *configuration.Config, rallyId *int64) {
-	if rallyId == nil {
-		log.Fatal("Rally ID must be provided for creating a rally")
+// Store opens the database on first use.
+func (a *app) Store() (*database.Store, error) {
+	if a.store != nil {
+		return a.store, nil
 	}
 
-	if err := database.CreateRally(*rallyId, config, store); err != nil {
-		log.Fatalf("Failed to create rally: %v", err)
-	}
-	log.Printf("Rally %d created successfully.\n", *rallyId)
-}
-
-// doReport will read data from the database given a single rally ID number. It
-// will then assign points to drivers and create a table for the single rally.
-// It will also produce a table with total points awarded to drivers across
-// all rallies in the championship.
-func doReport(store *database.Store, config *configuration.Config, rallyId *int64) {
-	if basicReport == nil {
-		log.Fatal("Rally ID must be provided for basic report")
+	config, err := a.Config()
+	if err != nil {
+		return nil, err
 	}
 
-	// Export the report to markdown file
-	if err := reports.ExportReport(*rallyId, store, config); err != nil {
-		log.Fatalf("Failed to export %d_points_summary_report: %v", *rallyId, err)
+	store, err := database.NewStore(config.DatabaseFile(), config)
+	if err != nil {
+		return nil, fail(exitDatabase, "failed to initialize database store: %w", err)
 	}
 
-	fmt.Printf("Report exported to %d_points_summary_report\n", *rallyId)
+	a.store = store
+	return store, nil
 }
 
-// doSummary will export the championship summary and driver summaries.
-func doSummary(store *database.Store, config *configuration.Config) {
-	if err := reports.ExportDriverSummaries(store, config); err != nil {
-		log.Fatalf("Failed to export drivers_summary: %v", err)
+// close releases the database if it was opened.
+func (a *app) close() {
+	if a.store != nil {
+		a.store.Close()
 	}
-	fmt.Println("Championship summary exported to drivers_summary")
 }
 
-// doDriver will export the driver rally summary for a single rally.
-// Driver summaries is 2 tables. The first table is a small amount of stats
-// compared to averages of the single rally. The second is a stage-by-stage
-// summary of the rally for each driver.
-func doDriver(store *database.Store, config *configuration.Config, rallyId *int64) {
-	if rallyId == nil {
-		log.Fatal("Rally ID must be provided for driver summaries")
-	}
-	if err := reports.DriverRallyReport(*rallyId, store, config); err != nil {
-		log.Fatalf("Failed to export %d_driver_rally_summary: %v", *rallyId, err)
+func createDirs(config *configuration.Config) error {
+	dirs := []string{
+		config.General.Directory,
+		config.DownloadDir(),
+		filepath.Dir(config.DatabaseFile()),
+		config.ReportDir(config.Report.MdDirectory),
+		config.ReportDir(config.Report.CsvDirectory),
 	}
-	fmt.Printf("Driver rally summary exported to %d_driver_rally_summary\n", *rallyId)
-}
 
-// doClass will export the class report for a single rally.
-// The class report groups drivers by class and shows the points awarded to
-// each class in the championship and that rally.
-func doClass(store *database.Store, config *configuration.Config, classReport *int64) {
-	if classReport == nil {
-		log.Fatal("Rally ID must be provided for class report")
-	}
-	if err := reports.ExportClassReport(*classReport, store, config); err != nil {
-		log.Fatalf("Failed to export %d_class_summary: %v", *classReport, err)
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory %q: %w", dir, err)
+		}
 	}
-	fmt.Printf("Class report exported to %d_class_summary\n", *classReport)
+	return nil
 }
@@ -0,0 +1,458 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/MorganPeterson/octanepoints/internal/configuration"
+	"github.com/MorganPeterson/octanepoints/internal/database"
+	"github.com/MorganPeterson/octanepoints/internal/grab"
+	"github.com/MorganPeterson/octanepoints/internal/parser"
+)
+
+var rallyGroup = &group{
+	name:    "rally",
+	summary: "Download rallies and manage them in the season database.",
+	commands: []*command{
+		{
+			name:    "grab",
+			args:    "[<rally-id>|<first>-<last>]...",
+			summary: "download raw rally data from RSF",
+			setup:   grabCommand,
+		},
+		{
+			name:    "describe",
+			args:    "<rally-id>...",
+			summary: "fill in the rally TOML from the downloaded results",
+			setup:   rallyCommand(doDescribe),
+		},
+		{
+			name:    "import",
+			args:    "<rally-id>",
+			summary: "load results files received from elsewhere under a rally ID",
+			setup:   importCommand,
+		},
+		{
+			name:    "validate",
+			args:    "<rally-id>...",
+			summary: "check the downloaded files of a rally without touching the database",
+			setup:   rallyCommand(doValidateRally),
+		},
+		{
+			name:    "create",
+			args:    "<rally-id>...",
+			summary: "put downloaded rally data into the database",
+			setup:   rallyCommand(doCreateRally),
+		},
+		{
+			name:    "recreate",
+			args:    "<rally-id>...",
+			summary: "replace rally data in the database and show what changed",
+			setup:   rallyCommand(doRecreateRally),
+		},
+		{
+			name:    "delete",
+			args:    "<rally-id>...",
+			summary: "remove a rally and its results from the database",
+			setup:   rallyCommand(doDeleteRally),
+		},
+		{
+			name:    "archive",
+			args:    "<rally-id>...",
+			summary: "keep a rally in the database but exclude it from the championship",
+			setup:   rallyCommand(func(a *app, id int64) error { return doArchiveRally(a, id, true) }),
+		},
+		{
+			name:    "unarchive",
+			args:    "<rally-id>...",
+			summary: "count an archived rally towards the championship again",
+			setup:   rallyCommand(func(a *app, id int64) error { return doArchiveRally(a, id, false) }),
+		},
+		{
+			name:    "all",
+			args:    "<rally-id>...",
+			summary: "grab, create and export every report for a rally in one go",
+			setup:   rallyCommand(doAllReports),
+		},
+	},
+}
+
+// rallyCommand builds a command that runs fn once for every rally ID given as
+// an argument, stopping at the first failure.
+func rallyCommand(fn func(a *app, rallyId int64) error) func(fs *flag.FlagSet) func(a *app, args []string) error {
+	return func(fs *flag.FlagSet) func(a *app, args []string) error {
+		return func(a *app, args []string) error {
+			ids, err := rallyArgs(nil, args)
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				if err := fn(a, id); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+}
+
+// doGrab gets a single rally's data from the RSF rally page and downloads it,
+// even when it was downloaded before. This does not require the database to
+// be set up.
+func doGrab(a *app, rallyId int64) error {
+	config, err := a.Config()
+	if err != nil {
+		return err
+	}
+
+	if err := grab.Grab(context.Background(), rallyId, config); err != nil {
+		return fail(exitDownload, "failed to grab rally data: %w", err)
+	}
+	log.Printf("Rally %d setup successfully.\n", rallyId)
+	return nil
+}
+
+// grabCommand downloads every rally given as an argument, or every rally of
+// the season with --season, a few at a time. Rallies downloaded before are
+// skipped unless --force is given. The rally TOML keeps what the user filled
+// in unless --force-template is given. A summary is printed at the end.
+func grabCommand(fs *flag.FlagSet) func(a *app, args []string) error {
+	force := fs.Bool("force", false, "download rallies again even when their files exist")
+	forceTemplate := fs.Bool("force-template", false, "overwrite the rally TOML instead of keeping what was filled in")
+	season := fs.Bool("season", false, "grab every rally listed in [[season.rallies]]")
+	workers := fs.Int("workers", 0, "rallies downloaded at the same time (default download.workers)")
+
+	return func(a *app, args []string) error {
+		config, err := a.Config()
+		if err != nil {
+			return err
+		}
+
+		var flagged rallyList
+		if *season {
+			if len(config.Season.Rallies) == 0 {
+				return fail(exitConfig, "--season given but no [[season.rallies]] are configured")
+			}
+			flagged = config.SeasonRallyIds()
+		}
+		ids, err := rallyArgs(flagged, args)
+		if err != nil {
+			return err
+		}
+		if *workers < 0 {
+			return fail(exitUsage, "--workers must be >= 0 (got %d)", *workers)
+		}
+
+		names := map[int64]string{}
+		for _, r := range config.Season.Rallies {
+			names[r.Id] = r.Name
+		}
+
+		opts := grab.BatchOptions{
+			Force:         *force,
+			ForceTemplate: *forceTemplate,
+			Workers:       *workers,
+			Progress: func(done, total int, r grab.BatchResult) {
+				label := fmt.Sprintf("Rally %d", r.Id)
+				if names[r.Id] != "" {
+					label += " (" + names[r.Id] + ")"
+				}
+				switch r.Status {
+				case grab.Failed:
+					log.Printf("[%d/%d] %s failed: %v\n", done, total, label, r.Err)
+				case grab.Skipped:
+					log.Printf("[%d/%d] %s skipped, already downloaded\n", done, total, label)
+				default:
+					log.Printf("[%d/%d] %s setup successfully.\n", done, total, label)
+				}
+			},
+		}
+
+		results, err := grab.GrabAll(context.Background(), ids, opts, config)
+		if err != nil {
+			return fail(exitDownload, "failed to grab rally data: %w", err)
+		}
+		return printGrabSummary(results)
+	}
+}
+
+// printGrabSummary prints how many rallies were grabbed, skipped and failed
+// and returns an error when any failed.
+func printGrabSummary(results []grab.BatchResult) error {
+	count := map[string]int{}
+	var failed []string
+	for _, r := range results {
+		count[r.Status]++
+		if r.Status == grab.Failed {
+			failed = append(failed, fmt.Sprintf("%d", r.Id))
+		}
+	}
+
+	fmt.Printf("Grabbed %d, skipped %d, failed %d rallies.\n",
+		count[grab.Succeeded], count[grab.Skipped], count[grab.Failed])
+	if len(failed) > 0 {
+		return fail(exitDownload, "failed to grab rallies %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// importCommand copies results files given with --stages and --overall, or
+// a zip archive given with --zip, into the download directory of a rally,
+// fills in its TOML from them and puts the rally into the database.
+func importCommand(fs *flag.FlagSet) func(a *app, args []string) error {
+	var src grab.ImportSource
+	fs.StringVar(&src.Stages, "stages", "", "stage results CSV file")
+	fs.StringVar(&src.Overall, "overall", "", "overall results CSV file")
+	fs.StringVar(&src.Zip, "zip", "", "zip archive holding both results files")
+	replace := fs.Bool("replace", false, "replace the rally if it is already in the database")
+
+	return func(a *app, args []string) error {
+		ids, err := rallyArgs(nil, args)
+		if err != nil {
+			return err
+		}
+		if len(ids) != 1 {
+			return fail(exitUsage, "rally import takes exactly one rally ID")
+		}
+		rallyId := ids[0]
+
+		config, err := a.Config()
+		if err != nil {
+			return err
+		}
+
+		res, err := grab.Import(rallyId, src, config)
+		if err != nil {
+			return fail(exitFailure, "failed to import rally: %w", err)
+		}
+		for _, f := range []grab.ImportedFile{res.Stages, res.Overall} {
+			log.Printf("Imported %d rows from %s (%s, %q separated).\n", f.Rows, f.Source, f.Encoding, f.Delimiter)
+		}
+
+		// the import below reports the cells that don't parse
+		if err := describeRally(a, rallyId, false); err != nil {
+			return err
+		}
+		if *replace {
+			return doRecreateRally(a, rallyId)
+		}
+		return doCreateRally(a, rallyId)
+	}
+}
+
+// doDescribe completes the description TOML of a downloaded rally from its
+// results and prints what was filled in and what disagrees with the results.
+func doDescribe(a *app, rallyId int64) error {
+	return describeRally(a, rallyId, true)
+}
+
+// describeRally is doDescribe, printing the cells of the results that don't
+// parse only when diagnose is set or describing fails because of them.
+func describeRally(a *app, rallyId int64, diagnose bool) error {
+	config, err := a.Config()
+	if err != nil {
+		return err
+	}
+
+	res, err := grab.Describe(rallyId, config)
+	if res != nil && (diagnose || err != nil) {
+		printDiagnostics(res.Diagnostics, config)
+	}
+	if err != nil {
+		if res != nil && len(res.Diagnostics) > 0 {
+			return fail(exitInvalid, "failed to describe rally: %w", err)
+		}
+		return fail(exitFailure, "failed to describe rally: %w", err)
+	}
+
+	if len(res.Filled) == 0 {
+		fmt.Printf("%s: nothing to fill in.\n", res.Path)
+	} else {
+		fmt.Printf("%s: filled in %s.\n", res.Path, strings.Join(res.Filled, ", "))
+	}
+	for _, c := range res.Conflicts {
+		fmt.Printf("! %s is %q but the results say %q\n", c.Field, c.Current, c.Derived)
+	}
+	return nil
+}
+
+// doAllReports Given a rally ID number, we run all reports in one go.
+// This is useful for generating all reports for a single rally in one command.
+func doAllReports(a *app, rallyId int64) error {
+	// If all reports are requested, we run the grab command first
+	if err := doGrab(a, rallyId); err != nil {
+		return err
+	}
+
+	if err := doCreateRally(a, rallyId); err != nil {
+		return err
+	}
+
+	for _, report := range rallyReports {
+		if err := report(a, rallyId); err != nil {
+			return err
+		}
+	}
+
+	return doSummary(a)
+}
+
+// doCreateRally Given a rally ID number, we read the raw csv data for a rally from the
+// rallies/[rally_id] directory and put it into the database.
+func doCreateRally(a *app, rallyId int64) error {
+	store, err := a.Store()
+	if err != nil {
+		return err
+	}
+
+	diags, err := database.CreateRally(rallyId, a.config, store)
+	printDiagnostics(diags, a.config)
+	if errors.Is(err, database.ErrBadCells) {
+		return fail(exitInvalid, "failed to create rally: %w", err)
+	}
+	if err != nil {
+		return fail(exitDatabase, "failed to create rally: %w", err)
+	}
+	log.Printf("Rally %d created successfully.\n", rallyId)
+	warnUnclassified(a)
+	warnUnmatchedRoster(a)
+	return nil
+}
+
+// doRecreateRally Given a rally ID number, we delete the rally's rows from the
+// database and read the raw csv data again. This is used when results are
+// re-downloaded after the organiser has corrected them. The changes to the
+// overall results are printed afterwards.
+func doRecreateRally(a *app, rallyId int64) error {
+	store, err := a.Store()
+	if err != nil {
+		return err
+	}
+
+	diff, diags, err := database.RecreateRally(rallyId, a.config, store)
+	printDiagnostics(diags, a.config)
+	if errors.Is(err, database.ErrBadCells) {
+		return fail(exitInvalid, "failed to recreate rally: %w", err)
+	}
+	if err != nil {
+		return fail(exitDatabase, "failed to recreate rally: %w", err)
+	}
+	log.Printf("Rally %d recreated successfully.\n", rallyId)
+	warnUnclassified(a)
+	warnUnmatchedRoster(a)
+
+	printRallyDiff(diff)
+	return nil
+}
+
+// doValidateRally checks the description and results files of a rally
+// without touching the database and prints every cell that doesn't parse.
+func doValidateRally(a *app, rallyId int64) error {
+	config, err := a.Config()
+	if err != nil {
+		return err
+	}
+
+	diags, err := database.ValidateRally(rallyId, config)
+	if err != nil {
+		return fail(exitInvalid, "rally %d: %w", rallyId, err)
+	}
+	if len(diags) == 0 {
+		fmt.Printf("Rally %d: no problems found.\n", rallyId)
+		return nil
+	}
+
+	fmt.Printf("Rally %d: %d cells don't parse:\n", rallyId, len(diags))
+	for _, d := range diags {
+		fmt.Printf("  %s\n", d)
+	}
+	return fail(exitInvalid, "rally %d has cells that don't parse", rallyId)
+}
+
+// printDiagnostics prints the cells of the results files that didn't parse
+// and what happened to their rows.
+func printDiagnostics(diags []parser.Diagnostic, config *configuration.Config) {
+	if len(diags) == 0 {
+		return
+	}
+
+	var outcome string
+	switch config.Download.OnBadCell {
+	case configuration.OnBadCellSkip:
+		outcome = "their rows were left out"
+	case configuration.OnBadCellWarn:
+		outcome = "they were read as zero"
+	default:
+		outcome = "nothing was stored"
+	}
+	fmt.Fprintf(os.Stderr, "%d cells don't parse, %s:\n", len(diags), outcome)
+	for _, d := range diags {
+		fmt.Fprintf(os.Stderr, "  %s\n", d)
+	}
+}
+
+// doDeleteRally removes a rally and all of its results from the database.
+func doDeleteRally(a *app, rallyId int64) error {
+	store, err := a.Store()
+	if err != nil {
+		return err
+	}
+
+	if err := database.DeleteRally(rallyId, store); err != nil {
+		return fail(exitDatabase, "failed to delete rally: %w", err)
+	}
+	log.Printf("Rally %d deleted successfully.\n", rallyId)
+	return nil
+}
+
+// doArchiveRally marks a rally as archived (or not). Archived rallies stay in
+// the database but are left out of the championship standings.
+func doArchiveRally(a *app, rallyId int64, archived bool) error {
+	store, err := a.Store()
+	if err != nil {
+		return err
+	}
+
+	if err := database.ArchiveRally(rallyId, archived, store); err != nil {
+		return fail(exitDatabase, "failed to update rally: %w", err)
+	}
+	if archived {
+		log.Printf("Rally %d archived successfully.\n", rallyId)
+	} else {
+		log.Printf("Rally %d unarchived successfully.\n", rallyId)
+	}
+	return nil
+}
+
+// printRallyDiff prints the differences between two imports of a rally.
+func printRallyDiff(diff *database.RallyDiff) {
+	if diff.Empty() {
+		fmt.Println("No changes in overall results.")
+		return
+	}
+
+	for _, r := range diff.Added {
+		fmt.Printf("+ %s: added at position %s (%s)\n", r.UserName, r.Position, parser.FmtDuration(r.Time3))
+	}
+	for _, r := range diff.Removed {
+		fmt.Printf("- %s: removed from position %s\n", r.UserName, r.Position)
+	}
+	for _, c := range diff.Changed {
+		fmt.Printf("~ %s:", c.UserName)
+		if c.OldPosition != c.NewPosition {
+			fmt.Printf(" position %s -> %s", c.OldPosition, c.NewPosition)
+		}
+		if c.OldTime != c.NewTime {
+			fmt.Printf(" time %s -> %s", parser.FmtDuration(c.OldTime), parser.FmtDuration(c.NewTime))
+		}
+		if c.OldPenalty != c.NewPenalty {
+			fmt.Printf(" penalty %.0fs -> %.0fs", c.OldPenalty, c.NewPenalty)
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/MorganPeterson/octanepoints/internal/reports"
+)
+
+var reportGroup = &group{
+	name:    "report",
+	summary: "Export reports for single rallies.",
+	commands: []*command{
+		{
+			name:    "points",
+			args:    "[rally-id...]",
+			summary: "export the rally points report and overall championship standings",
+			setup:   reportCommand(doReport),
+		},
+		{
+			name:    "driver",
+			args:    "[rally-id...]",
+			summary: "export the per-driver stage summaries for a rally",
+			setup:   reportCommand(doDriver),
+		},
+		{
+			name:    "class",
+			args:    "[rally-id...]",
+			summary: "export the class points report for a rally",
+			setup:   reportCommand(doClass),
+		},
+		{
+			name:    "team",
+			args:    "[rally-id...]",
+			summary: "export the team results for a rally and the team championship",
+			setup:   reportCommand(doTeam),
+		},
+		{
+			name:    "manufacturer",
+			args:    "[rally-id...]",
+			summary: "export the manufacturer results for a rally and the manufacturer championship",
+			setup:   reportCommand(doManufacturer),
+		},
+		{
+			name:    "nations",
+			args:    "[rally-id...]",
+			summary: "export the nations cup results for a rally and the nations cup standings",
+			setup:   reportCommand(doNations),
+		},
+	},
+}
+
+var seasonGroup = &group{
+	name:    "season",
+	summary: "Export reports covering the whole season.",
+	commands: []*command{
+		{
+			name:    "summary",
+			summary: "export driver point summaries for the championship so far",
+			setup: func(fs *flag.FlagSet) func(a *app, args []string) error {
+				return func(a *app, args []string) error {
+					if len(args) > 0 {
+						return fail(exitUsage, "season summary takes no arguments")
+					}
+					return doSummary(a)
+				}
+			},
+		},
+	},
+}
+
+// rallyReports are the reports exported for a single rally by "rally all".
+var rallyReports = []func(a *app, rallyId int64) error{
+	doReport,
+	doDriver,
+	doClass,
+	doTeam,
+	doManufacturer,
+	doNations,
+}
+
+// reportCommand builds a report command taking rally IDs from --rally flags
+// and positional arguments, exporting the report for each of them.
+func reportCommand(fn func(a *app, rallyId int64) error) func(fs *flag.FlagSet) func(a *app, args []string) error {
+	return func(fs *flag.FlagSet) func(a *app, args []string) error {
+		var rallies rallyList
+		fs.Var(&rallies, "rally", "rally ID to report on; may be repeated or comma separated")
+
+		return func(a *app, args []string) error {
+			ids, err := rallyArgs(rallies, args)
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				if err := fn(a, id); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+}
+
+// doReport will read data from the database given a single rally ID number. It
+// will then assign points to drivers and create a table for the single rally.
+// It will also produce a table with total points awarded to drivers across
+// all rallies in the championship.
+func doReport(a *app, rallyId int64) error {
+	store, err := a.Store()
+	if err != nil {
+		return err
+	}
+
+	// Export the report to markdown file
+	if err := reports.ExportReport(rallyId, store, a.config); err != nil {
+		return fail(exitReport, "failed to export %d_points_summary_report: %w", rallyId, err)
+	}
+
+	log.Printf("Report exported to %d_points_summary_report\n", rallyId)
+	return nil
+}
+
+// doSummary will export the championship summary and driver summaries.
+func doSummary(a *app) error {
+	store, err := a.Store()
+	if err != nil {
+		return err
+	}
+
+	if err := reports.ExportDriverSummaries(store, a.config); err != nil {
+		return fail(exitReport, "failed to export drivers_summary: %w", err)
+	}
+	log.Println("Championship summary exported to drivers_summary")
+	return nil
+}
+
+// doDriver will export the driver rally summary for a single rally.
+// Driver summaries is 2 tables. The first table is a small amount of stats
+// compared to averages of the single rally. The second is a stage-by-stage
+// summary of the rally for each driver.
+func doDriver(a *app, rallyId int64) error {
+	store, err := a.Store()
+	if err != nil {
+		return err
+	}
+
+	if err := reports.DriverRallyReport(rallyId, store, a.config); err != nil {
+		return fail(exitReport, "failed to export %d_driver_rally_summary: %w", rallyId, err)
+	}
+	log.Printf("Driver rally summary exported to %d_driver_rally_summary\n", rallyId)
+	return nil
+}
+
+// doClass will export the class report for a single rally.
+// The class report groups drivers by class and shows the points awarded to
+// each class in the championship and that rally.
+func doClass(a *app, rallyId int64) error {
+	store, err := a.Store()
+	if err != nil {
+		return err
+	}
+
+	if err := reports.ExportClassReport(rallyId, store, a.config); err != nil {
+		return fail(exitReport, "failed to export %d_class_summary: %w", rallyId, err)
+	}
+	log.Printf("Class report exported to %d_class_summary\n", rallyId)
+	return nil
+}
+
+// doTeam will export the team report for a single rally. Leagues without
+// teams in the configuration are skipped.
+func doTeam(a *app, rallyId int64) error {
+	store, err := a.Store()
+	if err != nil {
+		return err
+	}
+
+	if len(a.config.Teams) == 0 {
+		log.Println("No teams configured, skipping the team report")
+		return nil
+	}
+
+	if err := reports.ExportTeamReport(rallyId, store, a.config); err != nil {
+		return fail(exitReport, "failed to export %d_%s: %w", rallyId, a.config.Report.Teams.SummaryFilename, err)
+	}
+	log.Printf("Team report exported to %d_%s\n", rallyId, a.config.Report.Teams.SummaryFilename)
+	return nil
+}
+
+// doManufacturer will export the manufacturer report for a single rally.
+func doManufacturer(a *app, rallyId int64) error {
+	store, err := a.Store()
+	if err != nil {
+		return err
+	}
+
+	fileName := a.config.Report.Manufacturers.SummaryFilename
+	if err := reports.ExportManufacturerReport(rallyId, store, a.config); err != nil {
+		return fail(exitReport, "failed to export %d_%s: %w", rallyId, fileName, err)
+	}
+	log.Printf("Manufacturer report exported to %d_%s\n", rallyId, fileName)
+	return nil
+}
+
+// doNations will export the nations cup report for a single rally.
+func doNations(a *app, rallyId int64) error {
+	store, err := a.Store()
+	if err != nil {
+		return err
+	}
+
+	fileName := a.config.Report.Nations.SummaryFilename
+	if err := reports.ExportNationsReport(rallyId, store, a.config); err != nil {
+		return fail(exitReport, "failed to export %d_%s: %w", rallyId, fileName, err)
+	}
+	log.Printf("Nations cup report exported to %d_%s\n", rallyId, fileName)
+	return nil
+}
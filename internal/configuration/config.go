@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/BurntSushi/toml"
@@ -16,6 +17,42 @@ const (
 	defaultDatabaseDir = "database"       // Default directory for database files
 	defaultDownloadDir = "rallies"        // Default directory for downloaded rally data
 	defaultDelimiter   = ";"              // Default CSV delimiter
+
+	defaultTimeoutSeconds   = 60            // Default time allowed for a download
+	defaultRetries          = 3             // Default retries after a failed download
+	defaultRetryWaitSeconds = 2             // Default wait before the first retry
+	defaultUserAgent        = "Wget/1.25.0" // RSF is happier talking to wget
+	defaultWorkers          = 2             // Default rallies downloaded at the same time
+	defaultDelaySeconds     = 1             // Default wait between starting two rally downloads
+)
+
+// Tie policies decide how points are awarded to drivers with identical times.
+const (
+	TieShared   = "shared"   // tied drivers share the better position and its full points
+	TieAverage  = "average"  // tied drivers split the points of the places they cover
+	TieTiebreak = "tiebreak" // ties are broken by best stage result, then fewer penalties
+)
+
+// Bad cell policies decide what happens to a row of a results file holding a
+// cell that doesn't parse.
+const (
+	OnBadCellAbort = "abort" // stop the import
+	OnBadCellSkip  = "skip"  // leave the row out
+	OnBadCellWarn  = "warn"  // keep the row with the cell read as zero
+)
+
+// Classes types decide what the classes of a championship are made of.
+const (
+	ClassesCar    = "car"    // classes of the cars driven
+	ClassesDriver = "driver" // class rosters of drivers
+	ClassesGroup  = "group"  // the RSF car groups of each rally
+)
+
+// Unknown car policies decide what happens to results driven in a car that
+// isn't in the cars table.
+const (
+	UnknownCarsAbort    = "abort"    // stop the import
+	UnknownCarsRegister = "register" // add the car to the Unclassified category
 )
 
 var defaultPoints = [...]int64{
@@ -26,10 +63,13 @@ var defaultPoints = [...]int64{
 // this table directly.
 type Config struct {
 	General  General  `toml:"general"`
+	Scoring  Scoring  `toml:"scoring"`
 	Download Download `toml:"download"`
 	Report   Report   `toml:"report"`
 	Database Database `toml:"database"`
+	Season   Season   `toml:"season"`
 	Classes  []Class  `toml:"classes"`
+	Teams    []Team   `toml:"teams"`
 }
 
 // General maps the [general] section.
@@ -38,8 +78,41 @@ type General struct {
 	gorm.Model
 	Points      []int64 `toml:"points"       gorm:"serializer:json"` // [32,28,…]
 	ClassPoints []int64 `toml:"classPoints"  gorm:"serializer:json"`
-	ClassesType string  `toml:"classesType"` // "driver"
+	ClassesType string  `toml:"classesType"` // "car", "driver" or "group"
 	Directory   string  `toml:"directory"`   // "data"
+	TiePolicy   string  `toml:"tiePolicy"`   // "shared", "average" or "tiebreak"
+	CountBest   int64   `toml:"countBest"`   // only the best N results count, 0 counts all
+}
+
+// Scoring maps the [scoring] section with bonus points earned on stages and
+// the rules deciding who scores points at all.
+type Scoring struct {
+	StageWinPoints      int64       `toml:"stageWinPoints"`      // bonus for every stage win
+	ManufacturerScorers int64       `toml:"manufacturerScorers"` // best N drivers per brand score per rally, 0 for all
+	NationScorers       int64       `toml:"nationScorers"`       // best N drivers per nation score per rally, 0 for all
+	PowerStage          PowerStage  `toml:"powerStage"`
+	Eligibility         Eligibility `toml:"eligibility"`
+}
+
+// Eligibility maps the [scoring.eligibility] section. Drivers who are not
+// eligible don't take up a points position and score the participation
+// points instead.
+type Eligibility struct {
+	RequireFinish       *bool    `toml:"requireFinish"`       // drivers without a finishing time are not eligible, default true
+	MaxSuperRally       int64    `toml:"maxSuperRally"`       // most super rallied stages allowed, 0 for no limit
+	SuperRallyFactor    *float64 `toml:"superRallyFactor"`    // position points multiplier for super rally finishers, default 1
+	ParticipationPoints int64    `toml:"participationPoints"` // points for starters who are not eligible
+}
+
+// PowerStage maps the [scoring.powerStage] section.
+type PowerStage struct {
+	Stage  string  `toml:"stage"`  // "first", "last" or a stage number, e.g. "5"
+	Points []int64 `toml:"points"` // [5, 4, 3, 2, 1]
+}
+
+// Enabled reports whether any stage bonus points are awarded.
+func (s Scoring) Enabled() bool {
+	return s.StageWinPoints > 0 || len(s.PowerStage.Points) > 0
 }
 
 // Download maps the [download] section. :contentReference[oaicite:9]{index=9}
@@ -47,22 +120,59 @@ type Download struct {
 	gorm.Model
 	RallyCSVURLTmpl     string `toml:"rallyCSVURLTmpl"`     // e.g. "https://…?rally_id=%d"
 	RallyCSVOverallTmpl string `toml:"rallyCSVOverallTmpl"` // e.g. "https://…?rally_id=%d&cg=7"
+	RallySummaryTmpl    string `toml:"rallySummaryTmpl"`    // rally summary page, e.g. "https://…?rally_id=%d"
 	Directory           string `toml:"directory"`           // "rallies"
 	StageFileName       string `toml:"stageFileName"`       // "table.csv"
 	OverallFileName     string `toml:"overallFileName"`     // "All_table.csv"
 	Delimiter           string `toml:"delimiter"`           // ";"
+	TimeoutSeconds      int64  `toml:"timeoutSeconds"`      // time allowed for a whole download, default 60
+	Retries             *int64 `toml:"retries"`             // retries after a failed download, default 3
+	RetryWaitSeconds    int64  `toml:"retryWaitSeconds"`    // wait before the first retry, doubled for each retry, default 2
+	Proxy               string `toml:"proxy"`               // e.g. "http://proxy:8080", empty uses HTTP_PROXY
+	UserAgent           string `toml:"userAgent"`           // User-Agent header sent with downloads
+	Workers             int64  `toml:"workers"`             // rallies downloaded at the same time, default 2
+	DelaySeconds        *int64 `toml:"delaySeconds"`        // wait between starting two rally downloads, default 1
+	OnBadCell           string `toml:"onBadCell"`           // "abort", "skip" or "warn", default "abort"
+	UnknownCars         string `toml:"unknownCars"`         // "abort" or "register", default "abort"
+
+	// Columns maps [download.columns]: other header names accepted for a
+	// results column, keyed by RSF's name, e.g. "User name" = ["Driver"].
+	Columns map[string][]string `toml:"columns" gorm:"-"`
+}
+
+// Season maps the [season] section.
+type Season struct {
+	Rallies []SeasonRally `toml:"rallies"`
+}
+
+// SeasonRally maps each [[season.rallies]] entry.
+type SeasonRally struct {
+	Id   int64  `toml:"id"`   // RSF rally ID, e.g. 15234
+	Name string `toml:"name"` // optional, only shown in progress messages
+}
+
+// SeasonRallyIds returns the IDs of the rallies listed in [[season.rallies]].
+func (c *Config) SeasonRallyIds() []int64 {
+	ids := make([]int64, len(c.Season.Rallies))
+	for i, r := range c.Season.Rallies {
+		ids[i] = r.Id
+	}
+	return ids
 }
 
 // Report maps the [report] section, embedding its subtables.
 type Report struct {
-	Directory    string        `toml:"directory"`    // "rally_reports"
-	Format       string        `toml:"format"`       // "markdown" or "csv" or "both"
-	MdDirectory  string        `toml:"mdDirectory"`  // "markdown"
-	CsvDirectory string        `toml:"csvDirectory"` // "csv"
-	Delimiter    string        `toml:"delimiter"`    // ";"
-	Class        ReportClass   `toml:"class"`
-	Points       ReportPoints  `toml:"points"`
-	Drivers      ReportDrivers `toml:"drivers"`
+	Directory     string              `toml:"directory"`    // "rally_reports"
+	Format        string              `toml:"format"`       // "markdown" or "csv" or "both"
+	MdDirectory   string              `toml:"mdDirectory"`  // "markdown"
+	CsvDirectory  string              `toml:"csvDirectory"` // "csv"
+	Delimiter     string              `toml:"delimiter"`    // ";"
+	Class         ReportClass         `toml:"class"`
+	Points        ReportPoints        `toml:"points"`
+	Drivers       ReportDrivers       `toml:"drivers"`
+	Teams         ReportTeams         `toml:"teams"`
+	Manufacturers ReportManufacturers `toml:"manufacturers"`
+	Nations       ReportNations       `toml:"nations"`
 }
 
 type ReportClass struct {
@@ -73,6 +183,18 @@ type ReportPoints struct {
 	SummaryFileName string `toml:"summaryFileName"` // "points_summary"
 }
 
+type ReportTeams struct {
+	SummaryFilename string `toml:"summaryFilename"` // "team_summary"
+}
+
+type ReportManufacturers struct {
+	SummaryFilename string `toml:"summaryFilename"` // "manufacturer_summary"
+}
+
+type ReportNations struct {
+	SummaryFilename string `toml:"summaryFilename"` // "nations_summary"
+}
+
 type ReportDrivers struct {
 	SeasonSummaryFilename string `toml:"seasonSummaryFilename"` // "drivers_summary"
 	RallySummaryFilename  string `toml:"rallySummaryFilename"`  // "drivers_rally_summary"
@@ -94,6 +216,78 @@ type Class struct {
 	Description string   `toml:"description"` // e.g. "Gold Class Drivers"
 	Categories  []string `toml:"categories" gorm:"serializer:json"`
 	Drivers     []string `toml:"drivers" gorm:"serializer:json"`
+	DriverIds   []int64  `toml:"driverIds" gorm:"serializer:json"` // RSF user IDs, for drivers not known by name
+	CarIds      []int64  `toml:"carIds" gorm:"serializer:json"`    // RSF car IDs of cars in the class
+	Cars        []string `toml:"cars" gorm:"serializer:json"`      // car name patterns, e.g. "Skoda *"
+	CountBest   *int64   `toml:"countBest"`                        // overrides general.countBest for this class
+
+	// Members are drivers or car categories in the class for a range of
+	// rallies only, e.g. after a mid-season promotion.
+	Members []ClassMembership `toml:"members" gorm:"serializer:json"`
+}
+
+// ClassMembership maps each [[classes.members]] entry: a driver, by user name
+// or RSF user ID, or a car category in the class from one rally to another.
+// Rallies are compared by ID.
+type ClassMembership struct {
+	Driver   string `toml:"driver"`   // user name of the driver
+	UserId   int64  `toml:"userId"`   // RSF user ID of the driver
+	Category string `toml:"category"` // car category
+	From     int64  `toml:"from"`     // first rally ID in the class, 0 for the start of the season
+	To       int64  `toml:"to"`       // last rally ID in the class, 0 for the end of the season
+}
+
+// Team maps each [[teams]] entry.
+type Team struct {
+	Name       string   `toml:"name"`       // e.g. "Red Arrows"
+	Drivers    []string `toml:"drivers"`    // user names of the team's drivers
+	MaxScorers int64    `toml:"maxScorers"` // best N drivers score per rally, 0 for all
+}
+
+// validateMembers checks that every [[classes.members]] entry names exactly
+// one driver or category with a sensible rally range, and that a category is
+// listed once per class.
+func (cl Class) validateMembers() error {
+	categories := map[string]bool{}
+	for _, c := range cl.Categories {
+		categories[c] = true
+	}
+
+	for i, m := range cl.Members {
+		named := 0
+		for _, set := range []bool{m.Driver != "", m.UserId != 0, m.Category != ""} {
+			if set {
+				named++
+			}
+		}
+		if named != 1 {
+			return fmt.Errorf("classes.members[%d] of %q must set exactly one of driver, userId or category", i, cl.Name)
+		}
+		if m.UserId < 0 || m.From < 0 || m.To < 0 {
+			return fmt.Errorf("classes.members[%d] of %q: userId, from and to must be >= 0", i, cl.Name)
+		}
+		if m.To != 0 && m.From > m.To {
+			return fmt.Errorf("classes.members[%d] of %q: from %d is after to %d", i, cl.Name, m.From, m.To)
+		}
+		if m.Category != "" {
+			if categories[m.Category] {
+				return fmt.Errorf("classes.members[%d] of %q: category %q is listed more than once", i, cl.Name, m.Category)
+			}
+			categories[m.Category] = true
+		}
+	}
+	return nil
+}
+
+// ClassCountBest returns how many results count towards the championship of
+// the named class, falling back to general.countBest.
+func (c *Config) ClassCountBest(name string) int64 {
+	for _, cl := range c.Classes {
+		if cl.Name == name && cl.CountBest != nil {
+			return *cl.CountBest
+		}
+	}
+	return c.General.CountBest
 }
 
 // validate sets defaults and enforces required fields.
@@ -106,6 +300,72 @@ func (c *Config) validate() error {
 		return fmt.Errorf("download.rallyCSVURLTmpl is required and must contain '%%d'")
 	}
 
+	if c.Download.RallySummaryTmpl != "" && !strings.Contains(c.Download.RallySummaryTmpl, "%d") {
+		return fmt.Errorf("download.rallySummaryTmpl must contain '%%d'")
+	}
+
+	if c.Download.TimeoutSeconds == 0 {
+		c.Download.TimeoutSeconds = defaultTimeoutSeconds
+	}
+	if c.Download.TimeoutSeconds < 0 {
+		return fmt.Errorf("download.timeoutSeconds must be > 0 (got %d)", c.Download.TimeoutSeconds)
+	}
+	if c.Download.Retries == nil {
+		retries := int64(defaultRetries)
+		c.Download.Retries = &retries
+	}
+	if *c.Download.Retries < 0 {
+		return fmt.Errorf("download.retries must be >= 0 (got %d)", *c.Download.Retries)
+	}
+	if c.Download.RetryWaitSeconds == 0 {
+		c.Download.RetryWaitSeconds = defaultRetryWaitSeconds
+	}
+	if c.Download.RetryWaitSeconds < 0 {
+		return fmt.Errorf("download.retryWaitSeconds must be >= 0 (got %d)", c.Download.RetryWaitSeconds)
+	}
+	if c.Download.UserAgent == "" {
+		c.Download.UserAgent = defaultUserAgent
+	}
+	if c.Download.Workers == 0 {
+		c.Download.Workers = defaultWorkers
+	}
+	if c.Download.Workers < 0 {
+		return fmt.Errorf("download.workers must be > 0 (got %d)", c.Download.Workers)
+	}
+	if c.Download.DelaySeconds == nil {
+		delay := int64(defaultDelaySeconds)
+		c.Download.DelaySeconds = &delay
+	}
+	if *c.Download.DelaySeconds < 0 {
+		return fmt.Errorf("download.delaySeconds must be >= 0 (got %d)", *c.Download.DelaySeconds)
+	}
+
+	if c.Download.OnBadCell == "" {
+		c.Download.OnBadCell = OnBadCellAbort
+	}
+	if c.Download.OnBadCell != OnBadCellAbort && c.Download.OnBadCell != OnBadCellSkip && c.Download.OnBadCell != OnBadCellWarn {
+		return fmt.Errorf("invalid download.onBadCell '%s': must be '%s', '%s', or '%s'",
+			c.Download.OnBadCell, OnBadCellAbort, OnBadCellSkip, OnBadCellWarn)
+	}
+	if c.Download.UnknownCars == "" {
+		c.Download.UnknownCars = UnknownCarsAbort
+	}
+	if c.Download.UnknownCars != UnknownCarsAbort && c.Download.UnknownCars != UnknownCarsRegister {
+		return fmt.Errorf("invalid download.unknownCars '%s': must be '%s' or '%s'",
+			c.Download.UnknownCars, UnknownCarsAbort, UnknownCarsRegister)
+	}
+
+	seasonIds := map[int64]struct{}{}
+	for _, r := range c.Season.Rallies {
+		if r.Id <= 0 {
+			return fmt.Errorf("season.rallies.id must be > 0 (got %d)", r.Id)
+		}
+		if _, ok := seasonIds[r.Id]; ok {
+			return fmt.Errorf("rally %d is listed twice in season.rallies", r.Id)
+		}
+		seasonIds[r.Id] = struct{}{}
+	}
+
 	d, err := oneRuneOrDefault(c.Report.Delimiter, defaultDelimiter)
 	if err != nil {
 		return fmt.Errorf("report.delimiter: %v", err)
@@ -120,6 +380,106 @@ func (c *Config) validate() error {
 		c.General.ClassPoints = append([]int64(nil), defaultPoints[:]...) // Use default class points if none specified
 	}
 
+	if c.General.ClassesType == "" {
+		c.General.ClassesType = ClassesCar
+	}
+	if c.General.ClassesType != ClassesCar && c.General.ClassesType != ClassesDriver && c.General.ClassesType != ClassesGroup {
+		return fmt.Errorf("invalid general.classesType '%s': must be '%s', '%s', or '%s'",
+			c.General.ClassesType, ClassesCar, ClassesDriver, ClassesGroup)
+	}
+
+	if c.General.TiePolicy == "" {
+		c.General.TiePolicy = TieShared
+	}
+	if c.General.TiePolicy != TieShared && c.General.TiePolicy != TieAverage && c.General.TiePolicy != TieTiebreak {
+		return fmt.Errorf("invalid general.tiePolicy '%s': must be '%s', '%s', or '%s'",
+			c.General.TiePolicy, TieShared, TieAverage, TieTiebreak)
+	}
+
+	if c.General.CountBest < 0 {
+		return fmt.Errorf("general.countBest must be >= 0 (got %d)", c.General.CountBest)
+	}
+	for _, cl := range c.Classes {
+		if cl.CountBest != nil && *cl.CountBest < 0 {
+			return fmt.Errorf("classes.countBest for %q must be >= 0 (got %d)", cl.Name, *cl.CountBest)
+		}
+		for _, id := range cl.DriverIds {
+			if id <= 0 {
+				return fmt.Errorf("classes.driverIds for %q must be > 0 (got %d)", cl.Name, id)
+			}
+		}
+		for _, id := range cl.CarIds {
+			if id <= 0 {
+				return fmt.Errorf("classes.carIds for %q must be > 0 (got %d)", cl.Name, id)
+			}
+		}
+		for _, p := range cl.Cars {
+			if strings.TrimSpace(p) == "" {
+				return fmt.Errorf("classes.cars for %q must not hold empty patterns", cl.Name)
+			}
+		}
+		if err := cl.validateMembers(); err != nil {
+			return err
+		}
+	}
+
+	if c.Scoring.StageWinPoints < 0 {
+		return fmt.Errorf("scoring.stageWinPoints must be >= 0 (got %d)", c.Scoring.StageWinPoints)
+	}
+	switch ps := c.Scoring.PowerStage.Stage; ps {
+	case "", "first", "last":
+	default:
+		if n, err := strconv.ParseInt(ps, 10, 64); err != nil || n < 1 {
+			return fmt.Errorf("invalid scoring.powerStage.stage '%s': must be 'first', 'last' or a stage number", ps)
+		}
+	}
+
+	teamOf := map[string]string{}
+	for _, t := range c.Teams {
+		if strings.TrimSpace(t.Name) == "" {
+			return fmt.Errorf("teams.name is required")
+		}
+		if t.MaxScorers < 0 {
+			return fmt.Errorf("teams.maxScorers for %q must be >= 0 (got %d)", t.Name, t.MaxScorers)
+		}
+		for _, d := range t.Drivers {
+			if other, ok := teamOf[d]; ok {
+				if other == t.Name {
+					return fmt.Errorf("driver %q is listed twice in team %q", d, t.Name)
+				}
+				return fmt.Errorf("driver %q is in teams %q and %q", d, other, t.Name)
+			}
+			teamOf[d] = t.Name
+		}
+	}
+
+	if c.Scoring.ManufacturerScorers < 0 {
+		return fmt.Errorf("scoring.manufacturerScorers must be >= 0 (got %d)", c.Scoring.ManufacturerScorers)
+	}
+
+	if c.Scoring.NationScorers < 0 {
+		return fmt.Errorf("scoring.nationScorers must be >= 0 (got %d)", c.Scoring.NationScorers)
+	}
+
+	elig := &c.Scoring.Eligibility
+	if elig.RequireFinish == nil {
+		requireFinish := true
+		elig.RequireFinish = &requireFinish
+	}
+	if elig.SuperRallyFactor == nil {
+		factor := 1.0
+		elig.SuperRallyFactor = &factor
+	}
+	if elig.MaxSuperRally < 0 {
+		return fmt.Errorf("scoring.eligibility.maxSuperRally must be >= 0 (got %d)", elig.MaxSuperRally)
+	}
+	if *elig.SuperRallyFactor < 0 {
+		return fmt.Errorf("scoring.eligibility.superRallyFactor must be >= 0 (got %g)", *elig.SuperRallyFactor)
+	}
+	if elig.ParticipationPoints < 0 {
+		return fmt.Errorf("scoring.eligibility.participationPoints must be >= 0 (got %d)", elig.ParticipationPoints)
+	}
+
 	if c.Report.Directory == "" {
 		c.Report.Directory = defaultReportDir // Use default report directory if none specified
 	}
@@ -132,6 +492,18 @@ func (c *Config) validate() error {
 		return fmt.Errorf("invalid report format '%s': must be 'markdown', 'csv', or 'both'", c.Report.Format)
 	}
 
+	if c.Report.Teams.SummaryFilename == "" {
+		c.Report.Teams.SummaryFilename = "team_summary"
+	}
+
+	if c.Report.Manufacturers.SummaryFilename == "" {
+		c.Report.Manufacturers.SummaryFilename = "manufacturer_summary"
+	}
+
+	if c.Report.Nations.SummaryFilename == "" {
+		c.Report.Nations.SummaryFilename = "nations_summary"
+	}
+
 	if c.Report.MdDirectory == "" {
 		c.Report.MdDirectory = "markdown" // Use markdown as default directory
 	}
@@ -175,24 +547,69 @@ func Load(path string) (*Config, error) {
 	return &cfg, nil
 }
 
-// MustLoad is like Load but panics on error. Useful in init().
-func MustLoad(path string) *Config {
-	base := filepath.Dir(path)
+// LoadFile is like Load but also resolves the data directory against the
+// directory holding the configuration file, so the program can be run from
+// anywhere. All other directories are relative to the data directory.
+func LoadFile(path string) (*Config, error) {
 	cfg, err := Load(path)
 	if err != nil {
-		panic(fmt.Sprintf("failed to load config: %+v", err))
+		return nil, err
 	}
 
-	cfg.Report.Directory = makeAbs(base, cfg.Report.Directory, defaultReportDir)
-	cfg.Report.MdDirectory = makeAbs(base, cfg.Report.MdDirectory, filepath.Join(defaultReportDir, "markdown"))
-	cfg.Report.CsvDirectory = makeAbs(base, cfg.Report.CsvDirectory, filepath.Join(defaultReportDir, "csv"))
+	base, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("resolving config directory: %w", err)
+	}
 	cfg.General.Directory = makeAbs(base, cfg.General.Directory, defaultDataDir)
-	cfg.Download.Directory = makeAbs(base, cfg.Download.Directory, defaultDownloadDir)
-	cfg.Database.Directory = makeAbs(base, cfg.Database.Directory, defaultDatabaseDir)
+
+	return cfg, nil
+}
+
+// MustLoad is like LoadFile but panics on error. Useful in init().
+func MustLoad(path string) *Config {
+	cfg, err := LoadFile(path)
+	if err != nil {
+		panic(fmt.Sprintf("failed to load config: %+v", err))
+	}
 
 	return cfg
 }
 
+// DownloadDir returns the directory downloaded rally data is stored in.
+func (c *Config) DownloadDir() string {
+	return joinDir(c.General.Directory, c.Download.Directory)
+}
+
+// RallyDir returns the directory holding the files of a single rally.
+func (c *Config) RallyDir(rallyId int64) string {
+	return filepath.Join(c.DownloadDir(), fmt.Sprintf("%d", rallyId))
+}
+
+// StageFile returns the path of a rally's downloaded stage results.
+func (c *Config) StageFile(rallyId int64) string {
+	return filepath.Join(c.RallyDir(rallyId), fmt.Sprintf("%d%s", rallyId, c.Download.StageFileName))
+}
+
+// OverallFile returns the path of a rally's downloaded overall results.
+func (c *Config) OverallFile(rallyId int64) string {
+	return filepath.Join(c.RallyDir(rallyId), fmt.Sprintf("%d_%s", rallyId, c.Download.OverallFileName))
+}
+
+// RallyFile returns the path of a rally's description TOML file.
+func (c *Config) RallyFile(rallyId int64) string {
+	return filepath.Join(c.RallyDir(rallyId), fmt.Sprintf("%d.toml", rallyId))
+}
+
+// DatabaseFile returns the path of the SQLite database file.
+func (c *Config) DatabaseFile() string {
+	return filepath.Join(joinDir(c.General.Directory, c.Database.Directory), c.Database.Name)
+}
+
+// ReportDir returns the report sub-directory sub, e.g. Report.MdDirectory.
+func (c *Config) ReportDir(sub string) string {
+	return joinDir(joinDir(c.General.Directory, c.Report.Directory), sub)
+}
+
 func makeAbs(base, p, def string) string {
 	if p == "" {
 		p = def
@@ -203,6 +620,14 @@ func makeAbs(base, p, def string) string {
 	return filepath.Clean(p)
 }
 
+// joinDir joins dir onto base unless dir is already absolute.
+func joinDir(base, dir string) string {
+	if filepath.IsAbs(dir) {
+		return filepath.Clean(dir)
+	}
+	return filepath.Join(base, dir)
+}
+
 func oneRuneOrDefault(s, def string) (string, error) {
 	r := []rune(s)
 	if len(r) == 0 {
@@ -19,20 +19,26 @@ type RallyDescription struct {
 
 // Rally mirrors the [rally] table in the TOML.
 type Rally struct {
-	RallyId          int64   `toml:"rallyId"  json:"rallyId"`
-	Name             string  `toml:"name"     json:"name"`
-	Description      string  `toml:"description" json:"description"`
-	Creator          string  `toml:"creator"  json:"creator"`
-	DamageLevel      string  `toml:"damageLevel" json:"damageLevel"`
-	NumberOfLegs     int64   `toml:"numberOfLegs" json:"numberOfLegs"`
-	SuperRally       bool    `toml:"superRally" json:"superRally"`
-	PacenotesOptions string  `toml:"pacenotesOptions" json:"pacenotesOptions"`
-	Started          int64   `toml:"started"  json:"started"`  // Unix seconds
-	Finished         int64   `toml:"finished" json:"finished"` // Unix seconds
-	TotalDistance    float64 `toml:"totalDistance" json:"totalDistance"`
-	CarGroups        string  `toml:"carGroups" json:"carGroups"` // comma-separated
-	StartAt          string  `toml:"startAt"  json:"startAt"`    // e.g. RFC3339 or free text
-	EndAt            string  `toml:"endAt"    json:"endAt"`
+	RallyId          int64    `toml:"rallyId"  json:"rallyId"`
+	Name             string   `toml:"name"     json:"name"`
+	Description      string   `toml:"description" json:"description"`
+	Creator          string   `toml:"creator"  json:"creator"`
+	DamageLevel      string   `toml:"damageLevel" json:"damageLevel"`
+	NumberOfLegs     int64    `toml:"numberOfLegs" json:"numberOfLegs"`
+	SuperRally       bool     `toml:"superRally" json:"superRally"`
+	PacenotesOptions string   `toml:"pacenotesOptions" json:"pacenotesOptions"`
+	Started          int64    `toml:"started"  json:"started"`  // number of drivers who started
+	Finished         int64    `toml:"finished" json:"finished"` // number of drivers who finished
+	TotalDistance    float64  `toml:"totalDistance" json:"totalDistance"`
+	CarGroups        string   `toml:"carGroups" json:"carGroups"` // comma-separated
+	StartAt          string   `toml:"startAt"  json:"startAt"`    // e.g. RFC3339 or free text
+	EndAt            string   `toml:"endAt"    json:"endAt"`
+	NumberOfStages   int64    `toml:"numberOfStages" json:"numberOfStages"`
+	StageNames       []string `toml:"stageNames" json:"stageNames"`
+	PowerStage       int64    `toml:"powerStage" json:"powerStage"`             // overrides scoring.powerStage.stage
+	PointsMultiplier float64  `toml:"pointsMultiplier" json:"pointsMultiplier"` // e.g. 2 for double points, 0 means 1
+	Points           []int64  `toml:"points" json:"points"`                     // overrides general.points for this rally
+	ClassPoints      []int64  `toml:"classPoints" json:"classPoints"`           // overrides general.classPoints for this rally
 }
 
 // CarGroupList returns a normalized list of car groups (split/trim) without
@@ -65,13 +71,26 @@ func (d *RallyDescription) Validate() error {
 		return fmt.Errorf("rally.totalDistance must be >= 0 (got %f)", r.TotalDistance)
 	}
 
+	if r.PowerStage < 0 {
+		return fmt.Errorf("rally.powerStage must be >= 0 (got %d)", r.PowerStage)
+	}
+
+	if r.PointsMultiplier < 0 {
+		return fmt.Errorf("rally.pointsMultiplier must be >= 0 (got %g)", r.PointsMultiplier)
+	}
+	for _, p := range append(append([]int64(nil), r.Points...), r.ClassPoints...) {
+		if p < 0 {
+			return fmt.Errorf("rally points must be >= 0 (got %d)", p)
+		}
+	}
+
 	if r.DamageLevel == "" {
 		return fmt.Errorf("damageLevel must be set, got: %s", r.DamageLevel)
 	}
 
-	// Started/Finished unix seconds consistency (if both provided).
-	if r.Started > 0 && r.Finished > 0 && r.Finished < r.Started {
-		return fmt.Errorf("rally.finished (%d) < rally.started (%d)", r.Finished, r.Started)
+	// More drivers can't finish than started (if both provided).
+	if r.Started > 0 && r.Finished > r.Started {
+		return fmt.Errorf("rally.finished (%d) > rally.started (%d)", r.Finished, r.Started)
 	}
 	// Optional: parse StartAt/EndAt if they look like RFC3339 and check ordering.
 	const layout = time.RFC3339
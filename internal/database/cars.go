@@ -0,0 +1,259 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/MorganPeterson/octanepoints/internal/parser"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UnclassifiedCategory is the category of cars registered from results
+// because they weren't in the catalog. They wait there for a real category.
+const UnclassifiedCategory = "Unclassified"
+
+// ListCars returns the cars in the catalog ordered by category, brand and
+// model. An empty category lists every car.
+func ListCars(store *Store, category string) ([]Cars, error) {
+	q := store.DB.Order("category, brand, model")
+	if category != "" {
+		q = q.Where("category = ?", category)
+	}
+
+	var cs []Cars
+	if err := q.Find(&cs).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch cars: %w", err)
+	}
+	return cs, nil
+}
+
+// AddCar puts a car into the catalog. A car without an RSF ID gets a local
+// one, see localRSFID.
+func AddCar(store *Store, car Cars) (*Cars, error) {
+	err := store.DB.Transaction(func(tx *gorm.DB) error {
+		if err := addCar(tx, &car); err != nil {
+			return err
+		}
+		return resolveClassCars(tx, store.config.Classes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &car, nil
+}
+
+func addCar(tx *gorm.DB, car *Cars) error {
+	car.Brand = strings.TrimSpace(car.Brand)
+	car.Model = strings.TrimSpace(car.Model)
+	car.Category = strings.TrimSpace(car.Category)
+	car.Slug = parser.Slugify(car.Brand + " " + car.Model)
+	if car.Slug == "" {
+		return fmt.Errorf("car slug is empty for car: %s %s", car.Brand, car.Model)
+	}
+	if car.Category == "" {
+		car.Category = UnclassifiedCategory
+	}
+
+	var count int64
+	if err := tx.Model(&Cars{}).Where("slug = ?", car.Slug).Count(&count).Error; err != nil {
+		return fmt.Errorf("looking up car %s: %w", car.Slug, err)
+	}
+	if count > 0 {
+		return fmt.Errorf("car %s is already in the catalog", car.Slug)
+	}
+
+	if car.RSFID == 0 {
+		id, err := localRSFID(tx)
+		if err != nil {
+			return err
+		}
+		car.RSFID = id
+	}
+
+	if err := tx.Create(car).Error; err != nil {
+		return fmt.Errorf("adding car %s: %w", car.Slug, err)
+	}
+	return addCategoryClass(tx, car.Category)
+}
+
+// localRSFID returns an RSF ID for a car that RSF's ID isn't known for.
+// Local IDs are negative so they never collide with RSF's.
+func localRSFID(tx *gorm.DB) (int64, error) {
+	var lowest int64
+	if err := tx.Model(&Cars{}).Select("COALESCE(MIN(rsf_id), 0)").Scan(&lowest).Error; err != nil {
+		return 0, fmt.Errorf("finding a local car ID: %w", err)
+	}
+	return min(lowest, 0) - 1, nil
+}
+
+// SetCarCategory moves a car, found by RSF ID or slug, to another category.
+func SetCarCategory(store *Store, car string, category string) (*Cars, error) {
+	category = strings.TrimSpace(category)
+	if category == "" {
+		return nil, errors.New("category is required")
+	}
+
+	var c Cars
+	err := store.DB.Transaction(func(tx *gorm.DB) error {
+		found, err := findCar(tx, car)
+		if err != nil {
+			return err
+		}
+		c = *found
+
+		c.Category = category
+		if err := tx.Model(&c).Update("category", category).Error; err != nil {
+			return fmt.Errorf("updating car %s: %w", c.Slug, err)
+		}
+		if err := addCategoryClass(tx, category); err != nil {
+			return err
+		}
+		return resolveClassCars(tx, store.config.Classes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// findCar looks up a car by RSF ID or slug.
+func findCar(tx *gorm.DB, car string) (*Cars, error) {
+	var c Cars
+	q := tx.Where("slug = ?", parser.Slugify(car))
+	if id, err := parser.ParseInt(car); err == nil && id != 0 {
+		q = tx.Where("rsf_id = ?", id)
+	}
+	if err := q.First(&c).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("car %q not found in database", car)
+		}
+		return nil, fmt.Errorf("looking up car %q: %w", car, err)
+	}
+	return &c, nil
+}
+
+// addCategoryClass creates the class named after a car category when it
+// doesn't exist yet. Its cars are linked by resolveClassCars.
+func addCategoryClass(tx *gorm.DB, category string) error {
+	class := Class{Name: category, Slug: parser.Slugify(category), Active: true}
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "slug"}},
+		DoNothing: true,
+	}).Create(&class).Error; err != nil {
+		return fmt.Errorf("upserting class %q: %w", category, err)
+	}
+	return nil
+}
+
+// SyncResult lists what SyncCars did to the catalog.
+type SyncResult struct {
+	Added   []Cars // new cars
+	Adopted []Cars // registered cars that got their RSF ID and category
+	Skipped []Cars // cars whose slug is taken by a car with another RSF ID
+}
+
+// SyncCars adds the cars in a cars.json file that aren't in the catalog yet.
+// A car registered from results under the same name takes over the RSF ID
+// and category from the file. Cars already in the catalog are left alone.
+func SyncCars(store *Store, path string) (*SyncResult, error) {
+	cars, err := readCarsFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &SyncResult{}
+	err = store.DB.Transaction(func(tx *gorm.DB) error {
+		for _, car := range cars {
+			var byID int64
+			if err := tx.Model(&Cars{}).Where("rsf_id = ?", car.RSFID).Count(&byID).Error; err != nil {
+				return fmt.Errorf("looking up car %d: %w", car.RSFID, err)
+			}
+			if byID > 0 {
+				continue
+			}
+
+			var existing Cars
+			err := tx.Where("slug = ?", car.Slug).First(&existing).Error
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				if err := addCar(tx, &car); err != nil {
+					return err
+				}
+				res.Added = append(res.Added, car)
+			case err != nil:
+				return fmt.Errorf("looking up car %s: %w", car.Slug, err)
+			case existing.RSFID < 0:
+				existing.RSFID, existing.Brand, existing.Model, existing.Category = car.RSFID, car.Brand, car.Model, car.Category
+				if err := tx.Save(&existing).Error; err != nil {
+					return fmt.Errorf("updating car %s: %w", car.Slug, err)
+				}
+				if err := addCategoryClass(tx, existing.Category); err != nil {
+					return err
+				}
+				res.Adopted = append(res.Adopted, existing)
+			default:
+				res.Skipped = append(res.Skipped, car)
+			}
+		}
+		return resolveClassCars(tx, store.config.Classes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// readCarsFile reads a cars.json file and works out the slugs of its cars.
+func readCarsFile(path string) ([]Cars, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var wrapper CarsWrapper
+	if err := json.Unmarshal(raw, &wrapper); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	// slugify car names and ensure they are unique
+	for i := range wrapper.Cars {
+		wrapper.Cars[i].Slug = parser.Slugify(wrapper.Cars[i].Brand + " " + wrapper.Cars[i].Model)
+		if wrapper.Cars[i].Slug == "" {
+			return nil, fmt.Errorf("car slug is empty for car: %s %s", wrapper.Cars[i].Brand, wrapper.Cars[i].Model)
+		}
+	}
+	return wrapper.Cars, nil
+}
+
+// registerCars adds the cars of the results that aren't in the catalog to
+// the Unclassified category and to known. The brand is the first word of
+// the car name as RSF writes it, the model the rest.
+func registerCars(tx *gorm.DB, recs []RallyOverall, known map[string]Cars) error {
+	names := map[string]string{}
+	for _, r := range recs {
+		slug := parser.Slugify(r.Car)
+		if _, ok := known[slug]; !ok && slug != "" {
+			names[slug] = strings.TrimSpace(r.Car)
+		}
+	}
+	slugs := make([]string, 0, len(names))
+	for slug := range names {
+		slugs = append(slugs, slug)
+	}
+	sort.Strings(slugs)
+
+	for _, slug := range slugs {
+		brand, model, _ := strings.Cut(names[slug], " ")
+		car := Cars{Brand: brand, Model: model, Category: UnclassifiedCategory}
+		if err := addCar(tx, &car); err != nil {
+			return err
+		}
+		known[car.Slug] = car
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/MorganPeterson/octanepoints/internal/configuration"
+	"github.com/MorganPeterson/octanepoints/internal/parser"
+	"gorm.io/gorm"
+)
+
+// CarClass is a class a car resolved to and the rule that put it there.
+type CarClass struct {
+	Car    Cars
+	Class  string // empty when the car is in no class
+	Reason string
+	From   int64 // first rally ID in the class, 0 for the start
+	To     int64 // last rally ID in the class, 0 for the end
+
+	classID int64
+}
+
+// carRule puts the cars it matches into a class, for a range of rallies.
+type carRule struct {
+	class    string
+	reason   string
+	from, to int64
+	match    func(Cars) bool
+}
+
+// carRules returns the rules of the configured classes in the order they are
+// tried: RSF car IDs, car name patterns, categories, then the categories of
+// ranged members.
+func carRules(classes []configuration.Class) []carRule {
+	var rules []carRule
+	for _, cl := range classes {
+		for _, id := range cl.CarIds {
+			rules = append(rules, carRule{
+				class:  cl.Name,
+				reason: fmt.Sprintf("RSF car ID %d", id),
+				match:  func(c Cars) bool { return c.RSFID == id },
+			})
+		}
+		for _, p := range cl.Cars {
+			re := carPattern(p)
+			rules = append(rules, carRule{
+				class:  cl.Name,
+				reason: fmt.Sprintf("car pattern %q", p),
+				match:  func(c Cars) bool { return re.MatchString(c.Brand + " " + c.Model) },
+			})
+		}
+		for _, cat := range cl.Categories {
+			rules = append(rules, carRule{
+				class:  cl.Name,
+				reason: fmt.Sprintf("category %q", cat),
+				match:  func(c Cars) bool { return c.Category == cat },
+			})
+		}
+		for _, m := range cl.Members {
+			if m.Category == "" {
+				continue
+			}
+			rules = append(rules, carRule{
+				class:  cl.Name,
+				reason: fmt.Sprintf("category %q", m.Category),
+				from:   m.From,
+				to:     m.To,
+				match:  func(c Cars) bool { return c.Category == m.Category },
+			})
+		}
+	}
+	return rules
+}
+
+// carPattern compiles a car name pattern, where * matches any text and ?
+// any single character, ignoring case.
+func carPattern(p string) *regexp.Regexp {
+	expr := regexp.QuoteMeta(strings.TrimSpace(p))
+	expr = strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(expr)
+	return regexp.MustCompile("(?i)^" + expr + "$")
+}
+
+// resolveCarClasses works out the classes of every car. A car is in every
+// configured class with a rule matching it, for the first such rule, and in
+// the class named after its category. Cars in no class get one CarClass
+// without a class.
+func resolveCarClasses(classes []configuration.Class, cars []Cars, known []Class) []CarClass {
+	rules := carRules(classes)
+	bySlug := make(map[string]Class, len(known))
+	for _, c := range known {
+		bySlug[c.Slug] = c
+	}
+
+	var res []CarClass
+	for _, car := range cars {
+		seen := map[string]bool{}
+		add := func(class, reason string, from, to int64) {
+			slug := parser.Slugify(class)
+			if _, ok := bySlug[slug]; !ok || seen[slug] {
+				return
+			}
+			seen[slug] = true
+			c := bySlug[slug]
+			res = append(res, CarClass{Car: car, Class: c.Name, Reason: reason, From: from, To: to, classID: c.ID})
+		}
+
+		for _, r := range rules {
+			if r.match(car) {
+				add(r.class, r.reason, r.from, r.to)
+			}
+		}
+		add(car.Category, "class of its category", 0, 0)
+
+		if len(seen) == 0 {
+			res = append(res, CarClass{Car: car, Reason: "no rule matches"})
+		}
+	}
+	return res
+}
+
+// ExplainCars returns the classes every car in the catalog resolved to and
+// why, ordered by category, brand and model.
+func ExplainCars(store *Store) ([]CarClass, error) {
+	return explainCars(store.DB, store.config.Classes)
+}
+
+func explainCars(db *gorm.DB, classes []configuration.Class) ([]CarClass, error) {
+	var cars []Cars
+	if err := db.Order("category, brand, model").Find(&cars).Error; err != nil {
+		return nil, fmt.Errorf("fetching cars: %w", err)
+	}
+	var known []Class
+	if err := db.Find(&known).Error; err != nil {
+		return nil, fmt.Errorf("fetching classes: %w", err)
+	}
+	return resolveCarClasses(classes, cars, known), nil
+}
+
+// resolveClassCars rebuilds the class cars from the configured classes and
+// the car catalog. It runs when the configuration is loaded and whenever the
+// catalog changes.
+func resolveClassCars(tx *gorm.DB, classes []configuration.Class) error {
+	resolved, err := explainCars(tx, classes)
+	if err != nil {
+		return err
+	}
+	var joins []ClassCar
+	for _, cc := range resolved {
+		if cc.Class == "" {
+			continue
+		}
+		joins = append(joins, ClassCar{
+			ClassID:   cc.classID,
+			CarID:     cc.Car.ID,
+			FromRally: cc.From,
+			ToRally:   cc.To,
+		})
+	}
+
+	if err := tx.Where("1 = 1").Delete(&ClassCar{}).Error; err != nil {
+		return fmt.Errorf("clearing class cars: %w", err)
+	}
+	if len(joins) > 0 {
+		if err := tx.CreateInBatches(&joins, 200).Error; err != nil {
+			return fmt.Errorf("storing class-car joins: %w", err)
+		}
+	}
+	return nil
+}
+
+// EntrantClass is a class a rally entrant resolved to and why.
+type EntrantClass struct {
+	UserName string
+	Car      string
+	Class    string // empty when the entrant is in no class
+	Reason   string
+}
+
+// ExplainEntrants returns the classes the entrants of a rally resolved to
+// and why, in the order of the results. Driver classes come from the class
+// rosters, car classes from the entrant's car and groups from the stage
+// results.
+func ExplainEntrants(store *Store, rallyId int64) ([]EntrantClass, error) {
+	var recs []RallyOverall
+	if err := store.DB.Where("rally_id = ?", rallyId).Order("id").Find(&recs).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch results of rally %d: %w", rallyId, err)
+	}
+	if len(recs) == 0 {
+		return nil, fmt.Errorf("rally %d not found in database", rallyId)
+	}
+	// stage results name entrants as the overall results did before drivers
+	// were resolved
+	entrants := make(map[int64]string, len(recs))
+	for _, r := range recs {
+		entrants[r.ID] = r.UserName
+	}
+	if err := resolveDrivers(store.DB, recs); err != nil {
+		return nil, err
+	}
+
+	var explain func(RallyOverall) []EntrantClass
+	switch ClassTypeFor(store.config.General.ClassesType) {
+	case DRIVER_CLASS:
+		entries, err := GetClassRosters(store)
+		if err != nil {
+			return nil, err
+		}
+		explain = func(r RallyOverall) []EntrantClass { return rosterClasses(entries, r) }
+	case GROUP_CLASS:
+		var stages []RallyStage
+		if err := store.DB.Where(`rally_id = ? AND "group" <> ''`, rallyId).Find(&stages).Error; err != nil {
+			return nil, fmt.Errorf("failed to fetch stage results of rally %d: %w", rallyId, err)
+		}
+		// keyed by user name like get_group_rankings.sql, the rally is fixed
+		groups := map[string]string{}
+		for _, st := range stages {
+			groups[st.UserName] = max(groups[st.UserName], st.Group)
+		}
+		explain = func(r RallyOverall) []EntrantClass {
+			g, ok := groups[entrants[r.ID]]
+			if !ok {
+				return nil
+			}
+			return []EntrantClass{{Class: g, Reason: "RSF group in the stage results"}}
+		}
+	default:
+		cars, err := ExplainCars(store)
+		if err != nil {
+			return nil, err
+		}
+		byCar := map[int64][]CarClass{}
+		for _, cc := range cars {
+			byCar[cc.Car.ID] = append(byCar[cc.Car.ID], cc)
+		}
+		explain = func(r RallyOverall) []EntrantClass {
+			var res []EntrantClass
+			for _, cc := range byCar[r.CarID] {
+				if cc.Class != "" && inRange(rallyId, cc.From, cc.To) {
+					res = append(res, EntrantClass{Class: cc.Class, Reason: cc.Reason})
+				}
+			}
+			return res
+		}
+	}
+
+	var res []EntrantClass
+	for _, r := range recs {
+		ecs := explain(r)
+		if len(ecs) == 0 {
+			ecs = []EntrantClass{{Reason: "no class for this rally"}}
+		}
+		for _, ec := range ecs {
+			ec.UserName, ec.Car = r.UserName, r.Car
+			res = append(res, ec)
+		}
+	}
+	return res, nil
+}
+
+// rosterClasses returns the classes whose roster puts the driver of a result
+// into them for the result's rally.
+func rosterClasses(entries []RosterEntry, r RallyOverall) []EntrantClass {
+	var res []EntrantClass
+	seen := map[string]bool{}
+	for _, re := range entries {
+		if !re.Matched() || re.Driver.UserId != r.UserId || seen[re.Class] || !inRange(r.RallyId, re.From, re.To) {
+			continue
+		}
+		seen[re.Class] = true
+		reason := fmt.Sprintf("roster name %q", re.UserName)
+		if re.UserId != 0 {
+			reason = fmt.Sprintf("roster RSF user ID %d", re.UserId)
+		}
+		res = append(res, EntrantClass{Class: re.Class, Reason: reason})
+	}
+	return res
+}
+
+// inRange reports whether a rally is within a membership's range of rallies.
+func inRange(rallyId, from, to int64) bool {
+	return (from == 0 || rallyId >= from) && (to == 0 || rallyId <= to)
+}
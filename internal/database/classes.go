@@ -0,0 +1,184 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/MorganPeterson/octanepoints/internal/configuration"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RosterEntry is a driver on a class roster and the driver they matched.
+type RosterEntry struct {
+	Class    string
+	UserName string // as written in the roster, empty when given by ID
+	UserId   int64  // as written in the roster, 0 when given by name
+	From     int64  // first rally ID in the class, 0 for the start
+	To       int64  // last rally ID in the class, 0 for the end
+	Driver   *Driver
+}
+
+// Matched reports whether the roster entry matched a driver with results.
+func (e RosterEntry) Matched() bool {
+	return e.Driver != nil
+}
+
+// GetClassRosters returns the class rosters with the drivers they matched,
+// ordered by class.
+func GetClassRosters(store *Store) ([]RosterEntry, error) {
+	var members []ClassMember
+	if err := store.DB.Order("class_id, user_name, user_id").Find(&members).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch class rosters: %w", err)
+	}
+	classes, err := GetClasses(store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch classes: %w", err)
+	}
+	m, err := newMemberMatcher(store.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]RosterEntry, len(members))
+	for i, cm := range members {
+		entries[i] = RosterEntry{
+			Class:    classes[cm.ClassID].Name,
+			UserName: cm.UserName,
+			UserId:   cm.UserId,
+			From:     cm.FromRally,
+			To:       cm.ToRally,
+		}
+		if d, ok := m.match(cm); ok {
+			entries[i].Driver = &d
+		}
+	}
+	return entries, nil
+}
+
+// resolveClassDrivers rebuilds the class drivers from the class rosters. It
+// runs when the configuration is loaded and after every rally import, so
+// drivers named on a roster join their class with their first rally.
+func resolveClassDrivers(tx *gorm.DB) error {
+	var members []ClassMember
+	if err := tx.Find(&members).Error; err != nil {
+		return fmt.Errorf("fetching class rosters: %w", err)
+	}
+	m, err := newMemberMatcher(tx)
+	if err != nil {
+		return err
+	}
+
+	var joins []ClassDriver
+	for _, cm := range members {
+		if d, ok := m.match(cm); ok {
+			joins = append(joins, ClassDriver{
+				ClassID:   cm.ClassID,
+				UserId:    d.UserId,
+				FromRally: cm.FromRally,
+				ToRally:   cm.ToRally,
+			})
+		}
+	}
+
+	if err := tx.Where("1 = 1").Delete(&ClassDriver{}).Error; err != nil {
+		return fmt.Errorf("clearing class drivers: %w", err)
+	}
+	if len(joins) > 0 {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "class_id"}, {Name: "user_id"}, {Name: "from_rally"}},
+			DoNothing: true,
+		}).Create(&joins).Error; err != nil {
+			return fmt.Errorf("upserting class-driver joins: %w", err)
+		}
+	}
+	return nil
+}
+
+// memberMatcher finds the drivers named on class rosters.
+type memberMatcher struct {
+	byName   map[string]Driver
+	byUserId map[int64]Driver
+}
+
+func newMemberMatcher(db *gorm.DB) (*memberMatcher, error) {
+	byName, err := driverNames(db)
+	if err != nil {
+		return nil, err
+	}
+	var ds []Driver
+	if err := db.Find(&ds).Error; err != nil {
+		return nil, fmt.Errorf("fetching drivers: %w", err)
+	}
+	byId := make(map[int64]Driver, len(ds))
+	for _, d := range ds {
+		byId[d.ID] = d
+	}
+	byUserId := make(map[int64]Driver, len(ds))
+	for _, d := range ds {
+		byUserId[d.UserId] = byId[d.Canonical()]
+	}
+	return &memberMatcher{byName: byName, byUserId: byUserId}, nil
+}
+
+// match returns the driver, after merges, a roster entry names. Entries by
+// RSF user ID are matched by ID, the others by any name the driver drove
+// under.
+func (m *memberMatcher) match(cm ClassMember) (Driver, bool) {
+	if cm.UserId != 0 {
+		d, ok := m.byUserId[cm.UserId]
+		return d, ok
+	}
+	d, ok := m.byName[cm.UserName]
+	return d, ok
+}
+
+// ClassChange is a driver or car category that is in a class for a range of
+// rallies only.
+type ClassChange struct {
+	ClassName string `gorm:"column:class_name"`
+	Member    string `gorm:"column:member"`
+	FromRally int64  `gorm:"column:from_rally"`
+	ToRally   int64  `gorm:"column:to_rally"`
+}
+
+// ClassTypeFor returns the class type of a general.classesType setting.
+func ClassTypeFor(classesType string) ClassType {
+	switch classesType {
+	case configuration.ClassesDriver:
+		return DRIVER_CLASS
+	case configuration.ClassesGroup:
+		return GROUP_CLASS
+	default:
+		return CAR_CLASS
+	}
+}
+
+// GetClassChanges fetches the time-bounded class memberships of drivers or,
+// for car classes, of car categories, ordered by class and first rally. RSF
+// car groups have none.
+func GetClassChanges(store *Store, classType ClassType) ([]ClassChange, error) {
+	var q *gorm.DB
+	switch classType {
+	case GROUP_CLASS:
+		return nil, nil
+	case DRIVER_CLASS:
+		q = store.DB.Table("class_drivers cd").
+			Select("DISTINCT c.name AS class_name, COALESCE(d.name, member.name) AS member, cd.from_rally, cd.to_rally").
+			Joins("JOIN classes c ON c.id = cd.class_id").
+			Joins("JOIN drivers member ON member.user_id = cd.user_id").
+			Joins("LEFT JOIN drivers d ON d.id = member.merged_into").
+			Where("cd.from_rally <> 0 OR cd.to_rally <> 0")
+	default:
+		q = store.DB.Table("class_cars cc").
+			Select("DISTINCT c.name AS class_name, car.category AS member, cc.from_rally, cc.to_rally").
+			Joins("JOIN classes c ON c.id = cc.class_id").
+			Joins("JOIN cars car ON car.id = cc.car_id").
+			Where("cc.from_rally <> 0 OR cc.to_rally <> 0")
+	}
+
+	var changes []ClassChange
+	if err := q.Order("class_name, from_rally, member").Scan(&changes).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch class changes: %w", err)
+	}
+	return changes, nil
+}
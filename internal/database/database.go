@@ -3,32 +3,205 @@ package database
 
 import (
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
 	"time"
 
 	"github.com/MorganPeterson/octanepoints/internal/configuration"
 	"github.com/MorganPeterson/octanepoints/internal/parser"
+	"gorm.io/gorm"
 )
 
+// ErrBadCells is returned when cells of the results files don't parse and
+// download.onBadCell is "abort".
+var ErrBadCells = errors.New("results files hold cells that don't parse")
+
 // CreateRally initializes a rally in the database by setting its description,
 // overall results, and stages based on the provided rally ID and configuration.
-func CreateRally(rallyId int64, config *configuration.Config, store *Store) error {
-	if err := setRally(rallyId, store, config); err != nil {
-		return fmt.Errorf("failed to store rally: %w", err)
+// Everything is written in a single transaction, so a failed import leaves
+// no partial rows behind. The cells of the results files that didn't parse
+// are returned; what happened to their rows depends on download.onBadCell.
+func CreateRally(rallyId int64, config *configuration.Config, store *Store) ([]parser.Diagnostic, error) {
+	data, err := readRally(rallyId, config)
+	if err != nil {
+		return data.diags, err
 	}
 
-	err := setOverall(rallyId, store, config)
+	return data.diags, store.DB.Transaction(func(tx *gorm.DB) error {
+		return importRally(tx, data)
+	})
+}
+
+// RecreateRally replaces a previously created rally with freshly read data.
+// The old rally, overall and stage rows are deleted and the rally is imported
+// again inside one transaction. The returned diff describes how the overall
+// results changed between the two imports.
+func RecreateRally(rallyId int64, config *configuration.Config, store *Store) (*RallyDiff, []parser.Diagnostic, error) {
+	data, err := readRally(rallyId, config)
 	if err != nil {
-		return fmt.Errorf("failed to store overall rally data: %w", err)
+		return nil, data.diags, err
+	}
+
+	var diff *RallyDiff
+	err = store.DB.Transaction(func(tx *gorm.DB) error {
+		var before []RallyOverall
+		if err := tx.Where("rally_id = ?", rallyId).Order("time3 asc").Find(&before).Error; err != nil {
+			return fmt.Errorf("fetching previous overall records: %w", err)
+		}
+
+		if err := deleteRallyRows(tx, rallyId); err != nil {
+			return err
+		}
+
+		if err := importRally(tx, data); err != nil {
+			return err
+		}
+
+		var after []RallyOverall
+		if err := tx.Where("rally_id = ?", rallyId).Order("time3 asc").Find(&after).Error; err != nil {
+			return fmt.Errorf("fetching new overall records: %w", err)
+		}
+
+		diff = diffOverall(rallyId, before, after)
+		return nil
+	})
+	if err != nil {
+		return nil, data.diags, err
+	}
+
+	return diff, data.diags, nil
+}
+
+// ValidateRally reads the description and results files of a rally the way
+// CreateRally does, without touching the database, and returns every cell
+// that doesn't parse. The error is for problems that stop the files from
+// being read at all, e.g. a missing file or column.
+func ValidateRally(rallyId int64, config *configuration.Config) ([]parser.Diagnostic, error) {
+	data, err := readRally(rallyId, config)
+	if errors.Is(err, ErrBadCells) {
+		err = nil
+	}
+	return data.diags, err
+}
+
+// rallyData is a rally read from its files, ready to be stored.
+type rallyData struct {
+	rally   *Rally
+	overall []RallyOverall
+	stages  []RallyStage
+	diags   []parser.Diagnostic
+
+	registerCars bool                  // add unknown cars instead of failing, see download.unknownCars
+	classes      []configuration.Class // to put registered cars into their classes
+}
+
+// readRally reads the rally description and results files. When cells don't
+// parse and download.onBadCell is "abort", the diagnostics are returned with
+// ErrBadCells.
+func readRally(rallyId int64, config *configuration.Config) (rallyData, error) {
+	data := rallyData{
+		registerCars: config.Download.UnknownCars == configuration.UnknownCarsRegister,
+		classes:      config.Classes,
 	}
+	var err error
 
-	err = setStages(rallyId, store, config)
+	if data.rally, err = parseRally(rallyId, config); err != nil {
+		return data, fmt.Errorf("failed to read rally: %w", err)
+	}
+
+	var diags []parser.Diagnostic
+	data.overall, diags, err = parseOverall(rallyId, config)
+	data.diags = append(data.diags, diags...)
+	if err != nil {
+		return data, fmt.Errorf("failed to read overall rally data: %w", err)
+	}
+
+	data.stages, diags, err = parseStages(rallyId, config)
+	data.diags = append(data.diags, diags...)
 	if err != nil {
-		return fmt.Errorf("failed to store rally stage data: %w", err)
+		return data, fmt.Errorf("failed to read rally stage data: %w", err)
+	}
+
+	if len(data.diags) > 0 && config.Download.OnBadCell == configuration.OnBadCellAbort {
+		return data, fmt.Errorf("%w: %d bad cells", ErrBadCells, len(data.diags))
+	}
+	return data, nil
+}
+
+// importRally stores the rally description, overall results and stages using
+// the given database handle, which is normally a transaction.
+func importRally(tx *gorm.DB, data rallyData) error {
+	if err := tx.Create(data.rally).Error; err != nil {
+		return fmt.Errorf("failed to store rally: %w", err)
+	}
+
+	if err := setOverall(tx, data.overall, data.registerCars); err != nil {
+		return fmt.Errorf("failed to store overall rally data: %w", err)
+	}
+
+	if data.registerCars {
+		if err := resolveClassCars(tx, data.classes); err != nil {
+			return fmt.Errorf("failed to link registered cars to classes: %w", err)
+		}
+	}
+
+	if len(data.stages) > 0 {
+		if err := tx.Create(&data.stages).Error; err != nil {
+			return fmt.Errorf("failed to store rally stage data: batch insert rally stage records in database: %w", err)
+		}
+	}
+
+	if err := linkDrivers(tx, data.rally.RallyId); err != nil {
+		return fmt.Errorf("failed to link drivers: %w", err)
+	}
+	if err := resolveClassDrivers(tx); err != nil {
+		return fmt.Errorf("failed to match class rosters: %w", err)
+	}
+
+	return nil
+}
+
+// deleteRallyRows removes the rally, overall and stage rows for a rally.
+func deleteRallyRows(tx *gorm.DB, rallyId int64) error {
+	if err := tx.Where("rally_id = ?", rallyId).Delete(&RallyStage{}).Error; err != nil {
+		return fmt.Errorf("deleting rally stage records: %w", err)
+	}
+	if err := tx.Where("rally_id = ?", rallyId).Delete(&RallyOverall{}).Error; err != nil {
+		return fmt.Errorf("deleting rally overall records: %w", err)
+	}
+	if err := tx.Where("rally_id = ?", rallyId).Delete(&Rally{}).Error; err != nil {
+		return fmt.Errorf("deleting rally: %w", err)
 	}
+	return nil
+}
+
+// DeleteRally removes a rally together with its overall and stage results in
+// a single transaction. It returns an error if the rally does not exist.
+func DeleteRally(rallyId int64, store *Store) error {
+	return store.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&Rally{}).Where("rally_id = ?", rallyId).Count(&count).Error; err != nil {
+			return fmt.Errorf("looking up rally: %w", err)
+		}
+		if count == 0 {
+			return fmt.Errorf("rally %d not found in database", rallyId)
+		}
+
+		return deleteRallyRows(tx, rallyId)
+	})
+}
 
+// ArchiveRally sets or clears the archived flag on a rally. Archived rallies
+// keep their data but no longer count towards championship standings.
+func ArchiveRally(rallyId int64, archived bool, store *Store) error {
+	res := store.DB.Model(&Rally{}).Where("rally_id = ?", rallyId).Update("archived", archived)
+	if res.Error != nil {
+		return fmt.Errorf("updating rally archived flag: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("rally %d not found in database", rallyId)
+	}
 	return nil
 }
 
@@ -42,39 +215,57 @@ func GetDriversRallySummary(store *Store, opts *QueryOpts) ([]RallyOverall, erro
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch driver rally summary: %w", err)
 	}
+	if err := resolveDrivers(store.DB, recs); err != nil {
+		return nil, err
+	}
 
 	return recs, nil
 }
 
 // GetRallyOverall fetches the overall results for a rally from the database table
-// rally_overalls. If the results are not found, it returns an error.
+// rally_overalls. If the results are not found, it returns an error. Without
+// a rally ID the results of all rallies that are not archived are returned.
+// Drivers without a finishing time come after the finishers. Results carry
+// the user ID and name of their driver, see resolveDrivers.
 func GetRallyOverall(store *Store, opts *QueryOpts) ([]RallyOverall, error) {
 	// Fetch all overall records from the database
 	var recs []RallyOverall
 
 	if opts != nil {
-		err := store.DB.Order("time3 asc").Where("rally_id = ?", *opts.RallyId).Find(&recs).Error
+		err := store.DB.Order("time3 = 0, time3 asc").Where("rally_id = ?", *opts.RallyId).Find(&recs).Error
 		if err != nil {
 			return nil, fmt.Errorf("fetching overall records: %w", err)
 		}
 	} else {
-		err := store.DB.Order("time3 asc").Find(&recs).Error
+		err := store.DB.Order("time3 = 0, time3 asc").
+			Where("rally_id NOT IN (?)", archivedRallies(store)).
+			Find(&recs).Error
 		if err != nil {
 			return nil, fmt.Errorf("fetching overall records: %w", err)
 		}
 	}
+	if err := resolveDrivers(store.DB, recs); err != nil {
+		return nil, err
+	}
 
 	return recs, nil
 }
 
-// GetRallyUserNames fetches the unique user names of drivers who participated
+// archivedRallies returns a subquery selecting the IDs of archived rallies.
+func archivedRallies(store *Store) *gorm.DB {
+	return store.DB.Model(&Rally{}).Select("rally_id").Where("archived = ?", true)
+}
+
+// GetRallyUserNames fetches the unique names of drivers who participated
 // in a specific rally from the database.
 func GetRallyUserNames(store *Store, rallyId int64) ([]string, error) {
 	var userNames []string
-	err := store.DB.Model(&RallyStage{}).
-		Where("rally_id = ?", rallyId).
-		Distinct("user_name").
-		Pluck("user_name", &userNames).Error
+	err := store.DB.Table("rally_stages rs").
+		Joins("LEFT JOIN drivers d ON d.id = rs.driver_id").
+		Where("rs.rally_id = ?", rallyId).
+		Distinct("COALESCE(d.name, rs.user_name)").
+		Order("COALESCE(d.name, rs.user_name)").
+		Pluck("COALESCE(d.name, rs.user_name)", &userNames).Error
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch user names: %w", err)
 	}
@@ -82,6 +273,69 @@ func GetRallyUserNames(store *Store, rallyId int64) ([]string, error) {
 	return userNames, nil
 }
 
+// GetRally fetches a single rally by its RSF rally ID.
+func GetRally(store *Store, rallyId int64) (*Rally, error) {
+	var r Rally
+	if err := store.DB.Where("rally_id = ?", rallyId).First(&r).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch rally %d: %w", rallyId, err)
+	}
+	return &r, nil
+}
+
+// GetRallies fetches all rallies from the database and returns them as a map
+// with the RSF rally ID as the key.
+func GetRallies(store *Store) (map[int64]Rally, error) {
+	var rs []Rally
+	if err := store.DB.Find(&rs).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch rallies: %w", err)
+	}
+	m := make(map[int64]Rally, len(rs))
+	for _, r := range rs {
+		m[r.RallyId] = r
+	}
+	return m, nil
+}
+
+// GetCars fetches all cars from the database and returns them as a map with
+// the car ID as the key.
+func GetCars(store *Store) (map[int64]Cars, error) {
+	var cs []Cars
+	if err := store.DB.Find(&cs).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch cars: %w", err)
+	}
+	m := make(map[int64]Cars, len(cs))
+	for _, c := range cs {
+		m[c.ID] = c
+	}
+	return m, nil
+}
+
+// GetTeamMembers fetches the rosters of all teams, with every driver under
+// their current name.
+func GetTeamMembers(store *Store) ([]TeamMember, error) {
+	var ms []TeamMember
+	err := store.DB.Table("team_drivers td").
+		Select("t.name AS team_name, t.max_scorers, td.user_name").
+		Joins("JOIN teams t ON t.id = td.team_id").
+		Order("t.name, td.user_name").
+		Scan(&ms).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch team members: %w", err)
+	}
+
+	// rosters name drivers by any user name they drove under
+	drivers, err := driverNames(store.DB)
+	if err != nil {
+		return nil, err
+	}
+	for i, m := range ms {
+		if d, ok := drivers[m.UserName]; ok {
+			ms[i].UserName = d.Name
+		}
+	}
+	return ms, nil
+}
+
 // GetClasses fetches all classes from the database and returns them as a map
 // with the class ID as the key.
 func GetClasses(store *Store) (map[int64]Class, error) {
@@ -98,17 +352,7 @@ func GetClasses(store *Store) (map[int64]Class, error) {
 
 // fetchCsv reads a CSV file from the specified path and returns its content as
 // a slice of string slices. It assumes the CSV uses semicolons as delimiters.
-func fetchCsv(path string, config *configuration.Config) ([][]string, error) {
-	currentDir, err := os.Getwd()
-	if err != nil {
-		return nil, fmt.Errorf("getting current directory: %w", err)
-	}
-	filePath := filepath.Join(
-		currentDir,
-		config.General.Directory,
-		config.Download.Directory,
-		path)
-
+func fetchCsv(filePath string, config *configuration.Config) ([][]string, error) {
 	f, err := os.Open(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("opening CSV file %s: %w", filePath, err)
@@ -120,86 +364,116 @@ func fetchCsv(path string, config *configuration.Config) ([][]string, error) {
 		return nil, fmt.Errorf("delimiter is not set in the configuration")
 	}
 	reader.Comma = rune(config.Download.Delimiter[0]) // Use the first character as the delimiter
+	reader.FieldsPerRecord = -1                       // columns are looked up by name, see readColumns
 
 	return reader.ReadAll()
 }
 
-// SetOverall stores the overall results from the CSV file into the database.
-func setOverall(rallyId int64, store *Store, config *configuration.Config) error {
-	csvPath := filepath.Join(
-		fmt.Sprintf("%d", rallyId),
-		fmt.Sprintf("%d_%s", rallyId, config.Download.OverallFileName),
-	)
+// readColumns reads a results CSV file and resolves its columns by header
+// name, accepting the aliases configured in [download.columns].
+func readColumns(filePath string, columns []parser.Column, config *configuration.Config) ([][]string, *parser.ColumnMap, error) {
+	r, err := fetchCsv(filePath, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(r) == 0 {
+		return nil, nil, fmt.Errorf("CSV file %s is empty", filePath)
+	}
+
+	cols, err := parser.MapColumns(r[0], columns, config.Download.Columns)
+	if err != nil {
+		return nil, nil, fmt.Errorf("CSV file %s: %w", filePath, err)
+	}
+	for _, row := range r[1:] {
+		if err := cols.Check(row); err != nil {
+			return nil, nil, fmt.Errorf("CSV file %s: %w", filePath, err)
+		}
+	}
+	return r[1:], cols, nil
+}
+
+// keepRow reports whether a row is stored, given whether a cell of it didn't
+// parse.
+func keepRow(bad bool, config *configuration.Config) bool {
+	return !bad || config.Download.OnBadCell != configuration.OnBadCellSkip
+}
 
-	r, err := fetchCsv(csvPath, config)
+// parseOverall reads the overall results from the CSV file.
+func parseOverall(rallyId int64, config *configuration.Config) ([]RallyOverall, []parser.Diagnostic, error) {
+	path := config.OverallFile(rallyId)
+	rows, cols, err := readColumns(path, parser.OverallColumns, config)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+
+	p := &parser.RowParser{File: path, Cols: cols}
+	var recs []RallyOverall
+	for i, row := range rows {
+		p.Row(i+2, row) // line 1 is the header
+		rec := RallyOverall{
+			RallyId:     rallyId,
+			UserId:      p.Int(parser.OverallUserId),
+			Position:    p.String(parser.OverallPosition),
+			UserName:    p.String(parser.OverallUserName),
+			RealName:    p.String(parser.OverallRealName),
+			Nationality: p.String(parser.OverallNationality),
+			Car:         p.String(parser.OverallCar),
+			Time3:       p.Duration(parser.OverallTime3),
+			SuperRally:  p.Int(parser.OverallSuperRally),
+			Penalty:     p.Float(parser.OverallPenalty),
+			Extra:       cols.Extra(row),
+		}
+
+		if keepRow(p.Bad(), config) {
+			recs = append(recs, rec)
+		}
 	}
 
+	return recs, p.Diagnostics, nil
+}
+
+// setOverall stores the overall results in the database, linking every
+// result to its car. Cars that aren't in the database are registered as
+// Unclassified when register is set and fail the import otherwise.
+func setOverall(db *gorm.DB, recs []RallyOverall, register bool) error {
 	var allCars []Cars
-	if err := store.DB.Find(&allCars).Error; err != nil {
+	if err := db.Find(&allCars).Error; err != nil {
 		return fmt.Errorf("failed to preload all cars: %w", err)
 	}
 	carMap := make(map[string]Cars, len(allCars))
 	for _, car := range allCars {
 		carMap[car.Slug] = car
 	}
+	if register {
+		if err := registerCars(db, recs, carMap); err != nil {
+			return fmt.Errorf("registering unknown cars: %w", err)
+		}
+	}
 
-	var recs []RallyOverall
-	for _, row := range r[1:] { // skip header row
-		// CSV columns: #;userid;user_name;real_name;nationality;car;time3;super_rally;penalty
-		// split car into name and brand based off of the first space in the string
-		carSlug := parser.Slugify(row[5])
+	for i := range recs {
+		carSlug := parser.Slugify(recs[i].Car)
 		car, ok := carMap[carSlug]
 		if !ok {
-			return fmt.Errorf("car %s not found in database", carSlug)
-		}
-		err = store.DB.Where("slug = ?", carSlug).Find(&car).Error
-		if err != nil {
-			return fmt.Errorf("failed to find car %s: %w", carSlug, err)
+			return fmt.Errorf("car %s not found in database (add it with 'cars add' or 'cars sync', or set download.unknownCars = \"register\")", carSlug)
 		}
-
-		rec := RallyOverall{
-			RallyId:     rallyId,
-			UserId:      parser.StringToInt(row[1]),
-			Position:    row[0],
-			UserName:    row[2],
-			RealName:    row[3],
-			Nationality: row[4],
-			Car:         row[5],
-			CarID:       car.ID,
-			Time3:       parser.HMS(row[6]),
-			SuperRally:  parser.StringToInt(row[7]),
-			Penalty:     parser.StringToFloat(row[8]),
-		}
-
-		recs = append(recs, rec)
+		recs[i].CarID = car.ID
 	}
 
-	if err := store.DB.Create(&recs).Error; err != nil {
+	if len(recs) == 0 {
+		return nil
+	}
+	if err := db.Create(&recs).Error; err != nil {
 		return fmt.Errorf("batch insert rally overall records in database: %w", err)
 	}
 
 	return nil
 }
 
-// setRally stores the rally information in the database.
-func setRally(rallyId int64, store *Store, config *configuration.Config) error {
-	currentDir, err := os.Getwd()
-	if err != nil {
-		return fmt.Errorf("getting current directory: %w", err)
-	}
-
-	rallyPath := filepath.Join(
-		currentDir,
-		config.General.Directory,
-		config.Download.Directory,
-		fmt.Sprintf("%d", rallyId),
-		fmt.Sprintf("%d.toml", rallyId),
-	)
-	desc, err := configuration.LoadRally(rallyPath)
+// parseRally reads the rally description TOML.
+func parseRally(rallyId int64, config *configuration.Config) (*Rally, error) {
+	desc, err := configuration.LoadRally(config.RallyFile(rallyId))
 	if err != nil {
-		return fmt.Errorf("loading rally description: %w", err)
+		return nil, fmt.Errorf("loading rally description: %w", err)
 	}
 
 	// Convert the loaded description into a Rally struct
@@ -216,72 +490,69 @@ func setRally(rallyId int64, store *Store, config *configuration.Config) error {
 		Finished:         desc.Rally.Finished,
 		TotalDistance:    desc.Rally.TotalDistance,
 		CarGroups:        desc.Rally.CarGroups,
+		PowerStage:       desc.Rally.PowerStage,
+		PointsMultiplier: desc.Rally.PointsMultiplier,
+		Points:           desc.Rally.Points,
+		ClassPoints:      desc.Rally.ClassPoints,
+	}
+	if rally.PointsMultiplier == 0 {
+		rally.PointsMultiplier = 1
 	}
 	if desc.Rally.StartAt != "" {
 		startAt, err := time.Parse("2006-01-02 15:04", desc.Rally.StartAt)
 		if err != nil {
-			return fmt.Errorf("parsing start time: %w", err)
+			return nil, fmt.Errorf("parsing start time: %w", err)
 		}
 		rally.StartAt = startAt
 	}
 	if desc.Rally.EndAt != "" {
 		endAt, err := time.Parse("2006-01-02 15:04", desc.Rally.EndAt)
 		if err != nil {
-			return fmt.Errorf("parsing end time: %w", err)
+			return nil, fmt.Errorf("parsing end time: %w", err)
 		}
 		rally.EndAt = endAt
 	}
 
-	// Store the rally information in the database
-	if err := store.DB.Create(rally).Error; err != nil {
-		return fmt.Errorf("storing rally in database: %w", err)
-	}
-
-	return nil
+	return rally, nil
 }
 
-// setStages stores the stages from the CSV file into the database.
-func setStages(rallyId int64, store *Store, config *configuration.Config) error {
-	csvPath := filepath.Join(
-		fmt.Sprintf("%d", rallyId),
-		fmt.Sprintf("%d%s", rallyId, config.Download.StageFileName),
-	)
-	r, err := fetchCsv(csvPath, config)
+// parseStages reads the stage results from the CSV file.
+func parseStages(rallyId int64, config *configuration.Config) ([]RallyStage, []parser.Diagnostic, error) {
+	path := config.StageFile(rallyId)
+	rows, cols, err := readColumns(path, parser.StageColumns, config)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
+	p := &parser.RowParser{File: path, Cols: cols}
 	var recs []RallyStage
-	for _, row := range r[1:] { // skip header row
-		if len(row) < 16 {
-			return fmt.Errorf("malformed row (len=%d): %v", len(row), row)
-		}
+	for i, row := range rows {
+		p.Row(i+2, row) // line 1 is the header
 		rec := RallyStage{
 			RallyId:        rallyId,
-			StageNum:       parser.StringToInt(row[0]),
-			StageName:      row[1],
-			Nationality:    row[2],
-			UserName:       row[3],
-			RealName:       row[4],
-			Group:          row[5],
-			CarName:        row[6],
-			Time1:          parser.StringToFloat(row[7]),
-			Time2:          parser.StringToFloat(row[8]),
-			Time3:          parser.StringToFloat(row[9]),
-			FinishRealTime: parser.RealTime(row[10]),
-			Penalty:        parser.StringToFloat(row[11]),
-			ServicePenalty: parser.StringToFloat(row[12]),
-			SuperRally:     parser.StringToBool(row[13]),
-			Progress:       row[14],
-			Comments:       row[15],
+			StageNum:       p.Int(parser.StageNum),
+			StageName:      p.String(parser.StageName),
+			Nationality:    p.String(parser.Nationality),
+			UserName:       p.String(parser.UserName),
+			RealName:       p.String(parser.RealName),
+			Group:          p.String(parser.Group),
+			CarName:        p.String(parser.CarName),
+			Time1:          p.Float(parser.Time1),
+			Time2:          p.Float(parser.Time2),
+			Time3:          p.Float(parser.Time3),
+			FinishRealTime: p.Time(parser.FinishRealTime),
+			Penalty:        p.Float(parser.Penalty),
+			ServicePenalty: p.Float(parser.ServicePenalty),
+			SuperRally:     p.Bool(parser.SuperRally),
+			Progress:       p.String(parser.Progress),
+			Comments:       p.String(parser.Comments),
+			Extra:          cols.Extra(row),
 		}
 
-		recs = append(recs, rec)
-	}
-
-	if err := store.DB.Create(&recs).Error; err != nil {
-		return fmt.Errorf("batch insert rally stage records in database: %w", err)
+		if keepRow(p.Bad(), config) {
+			recs = append(recs, rec)
+		}
 	}
 
-	return nil
+	return recs, p.Diagnostics, nil
 }
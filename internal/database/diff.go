@@ -0,0 +1,79 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+// RallyDiff describes how the overall results of a rally changed between two
+// imports of the same rally.
+type RallyDiff struct {
+	RallyId int64
+	Added   []RallyOverall // drivers only present in the new import
+	Removed []RallyOverall // drivers only present in the old import
+	Changed []DriverChange // drivers whose position, time or penalty changed
+}
+
+// DriverChange holds the old and new overall values for a single driver.
+type DriverChange struct {
+	UserId      int64
+	UserName    string
+	OldPosition string
+	NewPosition string
+	OldTime     time.Duration
+	NewTime     time.Duration
+	OldPenalty  float64
+	NewPenalty  float64
+}
+
+// Empty reports whether the two imports were identical.
+func (d *RallyDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// diffOverall compares two sets of overall results for the same rally,
+// matching drivers by their RSF user ID.
+func diffOverall(rallyId int64, before, after []RallyOverall) *RallyDiff {
+	diff := &RallyDiff{RallyId: rallyId}
+
+	old := make(map[int64]RallyOverall, len(before))
+	for _, r := range before {
+		old[r.UserId] = r
+	}
+
+	seen := make(map[int64]struct{}, len(after))
+	for _, r := range after {
+		seen[r.UserId] = struct{}{}
+
+		prev, ok := old[r.UserId]
+		if !ok {
+			diff.Added = append(diff.Added, r)
+			continue
+		}
+
+		if prev.Position != r.Position || prev.Time3 != r.Time3 || prev.Penalty != r.Penalty {
+			diff.Changed = append(diff.Changed, DriverChange{
+				UserId:      r.UserId,
+				UserName:    r.UserName,
+				OldPosition: prev.Position,
+				NewPosition: r.Position,
+				OldTime:     prev.Time3,
+				NewTime:     r.Time3,
+				OldPenalty:  prev.Penalty,
+				NewPenalty:  r.Penalty,
+			})
+		}
+	}
+
+	for _, r := range before {
+		if _, ok := seen[r.UserId]; !ok {
+			diff.Removed = append(diff.Removed, r)
+		}
+	}
+
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		return diff.Changed[i].UserName < diff.Changed[j].UserName
+	})
+
+	return diff
+}
@@ -0,0 +1,282 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ListDrivers returns the drivers that weren't merged into another driver,
+// ordered by name.
+func ListDrivers(store *Store) ([]Driver, error) {
+	var ds []Driver
+	if err := store.DB.Where("merged_into = 0").Order("name").Find(&ds).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch drivers: %w", err)
+	}
+	return ds, nil
+}
+
+// DriverAliases returns the other user names and RSF user IDs each driver,
+// keyed by driver ID, has driven under.
+func DriverAliases(store *Store) (map[int64][]string, error) {
+	var all []Driver
+	if err := store.DB.Find(&all).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch drivers: %w", err)
+	}
+	var names []DriverName
+	if err := store.DB.Order("first_rally_id").Find(&names).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch driver names: %w", err)
+	}
+
+	byId := make(map[int64]Driver, len(all))
+	for _, d := range all {
+		byId[d.ID] = d
+	}
+
+	aliases := map[int64][]string{}
+	seen := map[int64]map[string]bool{}
+	add := func(id int64, alias string) {
+		if seen[id] == nil {
+			seen[id] = map[string]bool{byId[id].Name: true}
+		}
+		if !seen[id][alias] {
+			seen[id][alias] = true
+			aliases[id] = append(aliases[id], alias)
+		}
+	}
+	for _, n := range names {
+		add(byId[n.DriverId].Canonical(), n.UserName)
+	}
+	for _, d := range all {
+		if d.MergedInto != 0 {
+			add(d.MergedInto, fmt.Sprintf("#%d", d.UserId))
+		}
+	}
+	return aliases, nil
+}
+
+// MergeDrivers counts the results of the driver known as from, by any user
+// name they drove under or their RSF user ID, for the driver known as to.
+// The merge is kept when rallies are imported again.
+func MergeDrivers(store *Store, from, to string) (*Driver, error) {
+	var target Driver
+	err := store.DB.Transaction(func(tx *gorm.DB) error {
+		src, err := findDriver(tx, from)
+		if err != nil {
+			return err
+		}
+		dst, err := findDriver(tx, to)
+		if err != nil {
+			return err
+		}
+		if src.ID == dst.ID {
+			return fmt.Errorf("%q and %q are already the same driver", from, to)
+		}
+		target = *dst
+
+		if err := tx.Model(&Driver{}).
+			Where("id = ? OR merged_into = ?", src.ID, src.ID).
+			Update("merged_into", dst.ID).Error; err != nil {
+			return fmt.Errorf("merging driver %q: %w", from, err)
+		}
+		for _, model := range []any{&RallyOverall{}, &RallyStage{}} {
+			if err := tx.Model(model).
+				Where("driver_id = ?", src.ID).
+				Update("driver_id", dst.ID).Error; err != nil {
+				return fmt.Errorf("moving results of %q: %w", from, err)
+			}
+		}
+		return resolveClassDrivers(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+// findDriver looks up the driver, after merges, known by a user name or,
+// failing that, an RSF user ID. A name used by more than one driver is the
+// one who drove under it last.
+func findDriver(tx *gorm.DB, driver string) (*Driver, error) {
+	driver = strings.TrimSpace(driver)
+
+	var d Driver
+	var n DriverName
+	err := tx.Where("user_name = ?", driver).Order("last_rally_id DESC").First(&n).Error
+	switch {
+	case err == nil:
+		err = tx.First(&d, n.DriverId).Error
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		err = tx.Where("name = ?", driver).First(&d).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			var userId int64
+			if _, scanErr := fmt.Sscan(driver, &userId); scanErr == nil {
+				err = tx.Where("user_id = ?", userId).First(&d).Error
+			}
+		}
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("driver %q not found in database", driver)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("looking up driver %q: %w", driver, err)
+	}
+
+	if d.MergedInto != 0 {
+		var into Driver
+		if err := tx.First(&into, d.MergedInto).Error; err != nil {
+			return nil, fmt.Errorf("looking up driver %q: %w", driver, err)
+		}
+		return &into, nil
+	}
+	return &d, nil
+}
+
+// linkDrivers records the drivers of a rally and their user names, and links
+// the rally's overall and stage rows to them. A driver's name is the one
+// from the latest rally they drove, under any of their merged accounts.
+func linkDrivers(tx *gorm.DB, rallyId int64) error {
+	var recs []RallyOverall
+	if err := tx.Where("rally_id = ? AND user_id <> 0", rallyId).Find(&recs).Error; err != nil {
+		return fmt.Errorf("fetching overall records: %w", err)
+	}
+
+	for _, r := range recs {
+		var d Driver
+		err := tx.Where("user_id = ?", r.UserId).First(&d).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			d = Driver{UserId: r.UserId, Name: r.UserName, Nationality: r.Nationality, LastRallyId: rallyId}
+			if err := tx.Create(&d).Error; err != nil {
+				return fmt.Errorf("adding driver %q: %w", r.UserName, err)
+			}
+		case err != nil:
+			return fmt.Errorf("looking up driver %d: %w", r.UserId, err)
+		default:
+			if err := renameDriver(tx, d, r, rallyId); err != nil {
+				return err
+			}
+		}
+
+		name := DriverName{DriverId: d.ID, UserName: r.UserName, FirstRallyId: rallyId, LastRallyId: rallyId}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "driver_id"}, {Name: "user_name"}},
+			DoUpdates: clause.Set{
+				{Column: clause.Column{Name: "first_rally_id"}, Value: gorm.Expr("MIN(first_rally_id, excluded.first_rally_id)")},
+				{Column: clause.Column{Name: "last_rally_id"}, Value: gorm.Expr("MAX(last_rally_id, excluded.last_rally_id)")},
+			},
+		}).Create(&name).Error; err != nil {
+			return fmt.Errorf("recording name %q: %w", r.UserName, err)
+		}
+
+		id := d.Canonical()
+		if err := tx.Model(&RallyOverall{}).
+			Where("rally_id = ? AND user_id = ?", rallyId, r.UserId).
+			Update("driver_id", id).Error; err != nil {
+			return fmt.Errorf("linking overall results of %q: %w", r.UserName, err)
+		}
+		if err := tx.Model(&RallyStage{}).
+			Where("rally_id = ? AND user_name = ?", rallyId, r.UserName).
+			Update("driver_id", id).Error; err != nil {
+			return fmt.Errorf("linking stage results of %q: %w", r.UserName, err)
+		}
+	}
+	return nil
+}
+
+// renameDriver gives the driver a result counts for, the one d was merged
+// into if any, the user name and nationality of the result when it is from
+// their latest rally.
+func renameDriver(tx *gorm.DB, d Driver, r RallyOverall, rallyId int64) error {
+	if d.MergedInto != 0 {
+		var into Driver
+		if err := tx.First(&into, d.MergedInto).Error; err != nil {
+			return fmt.Errorf("looking up driver %d: %w", d.MergedInto, err)
+		}
+		d = into
+	}
+	if rallyId < d.LastRallyId {
+		return nil
+	}
+
+	d.Name, d.Nationality, d.LastRallyId = r.UserName, r.Nationality, rallyId
+	if err := tx.Save(&d).Error; err != nil {
+		return fmt.Errorf("updating driver %q: %w", r.UserName, err)
+	}
+	return nil
+}
+
+// linkAllDrivers links the rallies imported before drivers were recorded.
+func linkAllDrivers(db *gorm.DB) error {
+	var ids []int64
+	if err := db.Model(&RallyOverall{}).
+		Where("driver_id = 0 AND user_id <> 0").
+		Distinct("rally_id").
+		Pluck("rally_id", &ids).Error; err != nil {
+		return fmt.Errorf("finding unlinked rallies: %w", err)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, id := range ids {
+			if err := linkDrivers(tx, id); err != nil {
+				return fmt.Errorf("rally %d: %w", id, err)
+			}
+		}
+		return nil
+	})
+}
+
+// resolveDrivers replaces the RSF user ID and user name of overall results
+// with those of their driver, so a driver's results stay together when they
+// rename their account or were merged.
+func resolveDrivers(db *gorm.DB, recs []RallyOverall) error {
+	var ds []Driver
+	if err := db.Find(&ds).Error; err != nil {
+		return fmt.Errorf("fetching drivers: %w", err)
+	}
+	byId := make(map[int64]Driver, len(ds))
+	for _, d := range ds {
+		byId[d.ID] = d
+	}
+
+	for i := range recs {
+		if d, ok := byId[recs[i].DriverId]; ok {
+			recs[i].UserId, recs[i].UserName = d.UserId, d.Name
+		}
+	}
+	return nil
+}
+
+// driverNames maps every user name drivers drove under to the name of their
+// driver after merges.
+func driverNames(db *gorm.DB) (map[string]Driver, error) {
+	var ds []Driver
+	if err := db.Find(&ds).Error; err != nil {
+		return nil, fmt.Errorf("fetching drivers: %w", err)
+	}
+	var names []DriverName
+	if err := db.Order("last_rally_id").Find(&names).Error; err != nil {
+		return nil, fmt.Errorf("fetching driver names: %w", err)
+	}
+
+	byId := make(map[int64]Driver, len(ds))
+	for _, d := range ds {
+		byId[d.ID] = d
+	}
+	m := make(map[string]Driver, len(names))
+	// later rallies win when a name was used by more than one driver
+	for _, n := range names {
+		m[n.UserName] = byId[byId[n.DriverId].Canonical()]
+	}
+	for _, d := range ds {
+		if d.MergedInto == 0 {
+			m[d.Name] = d
+		}
+	}
+	return m, nil
+}
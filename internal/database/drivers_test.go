@@ -0,0 +1,73 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MorganPeterson/octanepoints/internal/configuration"
+)
+
+func TestLinkDriversMergeThenRename(t *testing.T) {
+	// the car catalog is seeded from the working directory
+	dir := t.TempDir()
+	t.Chdir(dir)
+	if err := os.WriteFile("cars.json", []byte(`{"cars": []}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := &configuration.Config{Classes: []configuration.Class{{Name: "Gold"}}}
+	store, err := NewStore(filepath.Join(dir, "test.db"), config)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	race := func(rallyId, userId int64, userName string) {
+		t.Helper()
+		rec := RallyOverall{RallyId: rallyId, UserId: userId, UserName: userName, Nationality: "HU"}
+		if err := store.DB.Create(&rec).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := linkDrivers(store.DB, rallyId); err != nil {
+			t.Fatalf("linkDrivers(%d): %v", rallyId, err)
+		}
+	}
+
+	race(1, 101, "Alice")
+	race(1, 102, "Bob")
+	alice, err := MergeDrivers(store, "Bob", "Alice")
+	if err != nil {
+		t.Fatalf("MergeDrivers: %v", err)
+	}
+
+	// the merged account races again under a new name
+	race(2, 102, "Bobby")
+
+	ds, err := ListDrivers(store)
+	if err != nil {
+		t.Fatalf("ListDrivers: %v", err)
+	}
+	if len(ds) != 1 || ds[0].ID != alice.ID || ds[0].Name != "Bobby" || ds[0].LastRallyId != 2 {
+		t.Fatalf("drivers = %+v, want driver %d named Bobby", ds, alice.ID)
+	}
+
+	var rec RallyOverall
+	if err := store.DB.Where("rally_id = 2").First(&rec).Error; err != nil {
+		t.Fatal(err)
+	}
+	if rec.DriverId != alice.ID {
+		t.Errorf("rally 2 counts for driver %d, want %d", rec.DriverId, alice.ID)
+	}
+
+	// linking an older rally again keeps the latest name
+	if err := linkDrivers(store.DB, 1); err != nil {
+		t.Fatalf("linkDrivers(1): %v", err)
+	}
+	var d Driver
+	if err := store.DB.First(&d, alice.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if d.Name != "Bobby" {
+		t.Errorf("name after relinking rally 1 = %q, want Bobby", d.Name)
+	}
+}
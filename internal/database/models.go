@@ -23,17 +23,84 @@ type Class struct {
 
 // ClassCar represents the many-to-many relationship between classes and cars.
 type ClassCar struct {
-	ClassID int64 `gorm:"primaryKey;index:idx_cc_class_id"` // Class ID
-	CarID   int64 `gorm:"primaryKey;index:idx_cc_car_id"`   // Car ID
+	ClassID   int64 `gorm:"primaryKey;index:idx_cc_class_id"` // Class ID
+	CarID     int64 `gorm:"primaryKey;index:idx_cc_car_id"`   // Car ID
+	FromRally int64 `gorm:"not null;default:0"`               // First rally ID in the class, 0 for the start
+	ToRally   int64 `gorm:"not null;default:0"`               // Last rally ID in the class, 0 for the end
 }
 
+// Driver is a driver of the championship, keyed by their RSF user ID. A
+// driver merged into another one has their results counted for that one.
+type Driver struct {
+	ID          int64  `gorm:"primaryKey;autoIncrement"` // Add an ID field for GORM
+	UserId      int64  `gorm:"not null;uniqueIndex"`     // RSF user ID
+	Name        string `gorm:"size:255;not null"`        // Latest user name
+	Nationality string `gorm:"size:255;not null"`        // Latest nationality
+	LastRallyId int64  `gorm:"not null;default:0"`       // Rally the name was taken from
+	MergedInto  int64  `gorm:"not null;default:0"`       // Driver ID this driver was merged into, 0 if none
+}
+
+// Canonical returns the ID of the driver the results are counted for.
+func (d Driver) Canonical() int64 {
+	if d.MergedInto != 0 {
+		return d.MergedInto
+	}
+	return d.ID
+}
+
+// DriverName is a user name a driver drove under and the rallies they did.
+type DriverName struct {
+	DriverId     int64  `gorm:"primaryKey"`                // Driver ID
+	UserName     string `gorm:"primaryKey;size:255;index"` // User name
+	FirstRallyId int64  `gorm:"not null"`                  // First rally driven under the name
+	LastRallyId  int64  `gorm:"not null"`                  // Last rally driven under the name
+}
+
+// ClassMember is a driver on a class roster as written in the configuration,
+// by user name or RSF user ID. Rosters may name drivers before their first
+// rally; members are matched to drivers whenever rallies are imported.
+type ClassMember struct {
+	ClassID   int64  `gorm:"primaryKey;index:idx_cm_class_id"` // Class ID
+	UserName  string `gorm:"primaryKey;size:255"`              // Driver user name, empty when given by ID
+	UserId    int64  `gorm:"primaryKey"`                       // RSF user ID, 0 when given by name
+	FromRally int64  `gorm:"primaryKey"`                       // First rally ID in the class, 0 for the start
+	ToRally   int64  `gorm:"not null;default:0"`               // Last rally ID in the class, 0 for the end
+}
+
+// ClassDriver links a class to a driver matched from its roster, for the
+// rallies from FromRally to ToRally.
 type ClassDriver struct {
-	ClassID int64 `gorm:"primaryKey;index:idx_cd_class_id"` // Class ID
-	UserId  int64 `gorm:"primaryKey;index:idx_cd_driver"`   // Driver name
+	ClassID   int64 `gorm:"primaryKey;index:idx_cd_class_id"` // Class ID
+	UserId    int64 `gorm:"primaryKey;index:idx_cd_driver"`   // Driver name
+	FromRally int64 `gorm:"primaryKey"`                       // First rally ID in the class, 0 for the start
+	ToRally   int64 `gorm:"not null;default:0"`               // Last rally ID in the class, 0 for the end
+}
+
+// Team represents a team in the team championship.
+type Team struct {
+	ID         int64  `gorm:"primaryKey;autoIncrement"`      // Add an ID field for GORM
+	Name       string `gorm:"size:255;uniqueIndex;not null"` // Name of the team
+	Slug       string `gorm:"size:255;uniqueIndex;not null"` // Slug for the team
+	MaxScorers int64  `gorm:"not null;default:0"`            // Best N drivers score per rally, 0 for all
+}
+
+// TeamDriver links a driver to a team. Drivers are kept by user name so they
+// can be on a roster before their first rally is imported.
+type TeamDriver struct {
+	TeamID   int64  `gorm:"primaryKey;index:idx_td_team_id"` // Team ID
+	UserName string `gorm:"primaryKey;size:255"`             // Driver user name
+}
+
+// TeamMember is a driver on a team's roster, as read for the team report.
+type TeamMember struct {
+	TeamName   string `gorm:"column:team_name"`
+	MaxScorers int64  `gorm:"column:max_scorers"`
+	UserName   string `gorm:"column:user_name"`
 }
 
 // DriverSummary holds all of the 10 summary metrics.
 type DriverSummary struct {
+	UserId                  int64   `gorm:"column:user_id"`
 	UserName                string  `gorm:"column:user_name"`
 	Nationality             string  `gorm:"column:nationality"`
 	RalliesStarted          int64   `gorm:"column:rallies_started"`
@@ -44,6 +111,7 @@ type DriverSummary struct {
 	AveragePosition         float64 `gorm:"column:average_position"`
 	TotalSuperRalliedStages int64   `gorm:"column:total_super_rallied_stages"`
 	TotalChampionshipPoints int64   `gorm:"column:total_championship_points"`
+	GrossChampionshipPoints int64   `gorm:"column:gross_championship_points"`
 }
 
 type ClassType int
@@ -51,6 +119,7 @@ type ClassType int
 const (
 	CAR_CLASS ClassType = iota
 	DRIVER_CLASS
+	GROUP_CLASS // the RSF car groups of the rally
 )
 
 type QueryOpts struct {
@@ -75,6 +144,11 @@ type Rally struct {
 	CarGroups        string    `gorm:"not null"`                 // Car groups allowed in the rally
 	StartAt          time.Time `gorm:"not null"`                 // Start time of the rally
 	EndAt            time.Time `gorm:"not null"`                 // End time of the rally
+	Archived         bool      `gorm:"not null;default:false"`   // Archived rallies do not count towards the championship
+	PowerStage       int64     `gorm:"not null;default:0"`       // Power stage number, 0 uses the configured stage
+	PointsMultiplier float64   `gorm:"not null;default:1"`       // Points for this rally are multiplied by this
+	Points           []int64   `gorm:"serializer:json"`          // Overall points table, empty uses general.points
+	ClassPoints      []int64   `gorm:"serializer:json"`          // Class points table, empty uses general.classPoints
 }
 
 // RallyOverall represents the overall results of a rally for a driver.
@@ -82,6 +156,7 @@ type RallyOverall struct {
 	ID          int64         `gorm:"primaryKey;autoIncrement"`       // Add an ID field for GORM
 	RallyId     int64         `gorm:"not null;index:idx_ro_rally_id"` // Use uint64 for RallyId
 	UserId      int64         `gorm:"not null"`                       // Use uint64 for UserId
+	DriverId    int64         `gorm:"default:0;index"`                // Driver the result counts for
 	Position    string        `gorm:"size:255;not null"`
 	UserName    string        `gorm:"size:255;not null"`
 	RealName    string        `gorm:"size:255;not null"`
@@ -91,12 +166,16 @@ type RallyOverall struct {
 	Time3       time.Duration `gorm:"not null"`
 	SuperRally  int64         `gorm:"not null"`
 	Penalty     float64       `gorm:"default:0"` // Use float64 for penalty, default to 0
+
+	// Extra holds the columns of the CSV file this program doesn't know.
+	Extra map[string]string `gorm:"serializer:json"`
 }
 
 // RallyStage represents a stage in a rally.
 type RallyStage struct {
 	ID             int64     `gorm:"primaryKey;autoIncrement"` // Add an ID field for GORM
 	RallyId        int64     `gorm:"not null"`
+	DriverId       int64     `gorm:"default:0;index"`   // Driver the result counts for
 	StageNum       int64     `gorm:"not null"`          // Stage number in the rally
 	StageName      string    `gorm:"size:255;not null"` // Name of the stage
 	Nationality    string    `gorm:"size:255;not null"` // Drivers nationality
@@ -113,15 +192,45 @@ type RallyStage struct {
 	SuperRally     bool      `gorm:"not null"`          // Whether the stage is part of a super rally
 	Progress       string    `gorm:"not null"`          // Progress of the stage
 	Comments       string    `gorm:"size:255;not null"` // Comments for the stage
+
+	// Extra holds the columns of the CSV file this program doesn't know.
+	Extra map[string]string `gorm:"serializer:json"`
 }
 
 type RankedRow struct {
-	RallyId  int64
-	ClassId  int64
-	UserId   int64
-	UserName string
-	Time3    int64
-	Pos      int64
+	RallyId    int64
+	ClassId    int64
+	UserId     int64
+	UserName   string
+	Time3      int64
+	Penalty    float64
+	SuperRally int64
+	Pos        int64
+}
+
+// StageBest holds the best stage position a driver reached in a rally.
+type StageBest struct {
+	RallyId   int64  `gorm:"column:rally_id"`
+	UserName  string `gorm:"column:user_name"`
+	BestStage int64  `gorm:"column:best_stage"`
+}
+
+// StagePosition is a driver's position on a single stage of a rally.
+type StagePosition struct {
+	RallyId  int64  `gorm:"column:rally_id"`
+	StageNum int64  `gorm:"column:stage_num"`
+	UserName string `gorm:"column:user_name"`
+	Position int64  `gorm:"column:position"`
+}
+
+// AwardedPoints are the championship points a driver scored in one rally.
+// They are calculated in Go and handed to the season summary query as JSON.
+type AwardedPoints struct {
+	RallyId  int64  `json:"rally_id"`
+	UserId   int64  `json:"user_id"`
+	UserName string `json:"user_name"`
+	Points   int64  `json:"points"`
+	Dropped  bool   `json:"dropped"` // not counted because only the best N results count
 }
 
 type StageSummary struct {
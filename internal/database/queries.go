@@ -7,8 +7,9 @@ import (
 	"sort"
 	"strings"
 
-	"github.com/MorganPeterson/octanepoints/internal/configuration"
+	"github.com/MorganPeterson/octanepoints/internal/parser"
 	"github.com/goccy/go-json"
+	"gorm.io/gorm"
 )
 
 var _ embed.FS
@@ -16,11 +17,15 @@ var _ embed.FS
 //go:embed sql_files/get_season_summary.sql
 var getSeasonSummarySQL string
 
-// GetSeasonSummaryQuery returns the SQL query to fetch the season summary.
-func GetSeasonSummary(store *Store, config *configuration.Config) ([]DriverSummary, error) {
+// GetSeasonSummary fetches the season summary. The championship points are
+// calculated by the caller and passed in as the points awarded per rally.
+func GetSeasonSummary(store *Store, awarded []AwardedPoints) ([]DriverSummary, error) {
 	var sums []DriverSummary
 
-	pnts, err := json.Marshal(config.General.Points)
+	if awarded == nil {
+		awarded = []AwardedPoints{}
+	}
+	pnts, err := json.Marshal(awarded)
 	if err != nil {
 		return sums, err
 	}
@@ -29,13 +34,54 @@ func GetSeasonSummary(store *Store, config *configuration.Config) ([]DriverSumma
 		return sums, err
 	}
 
-	sort.Slice(sums, func(i, j int) bool {
-		return sums[i].TotalChampionshipPoints > sums[j].TotalChampionshipPoints
+	// gross points settle drivers level on the counted results, as in the
+	// championship standings; the query orders full ties by name
+	sort.SliceStable(sums, func(i, j int) bool {
+		if sums[i].TotalChampionshipPoints != sums[j].TotalChampionshipPoints {
+			return sums[i].TotalChampionshipPoints > sums[j].TotalChampionshipPoints
+		}
+		return sums[i].GrossChampionshipPoints > sums[j].GrossChampionshipPoints
 	})
 
 	return sums, nil
 }
 
+//go:embed sql_files/get_stage_bests.sql
+var getStageBestsSQL string
+
+// GetStageBests fetches the best stage position of every driver, either for a
+// single rally or, without a rally ID, for all rallies.
+func GetStageBests(store *Store, opts *QueryOpts) ([]StageBest, error) {
+	var rallyId *int64
+	if opts != nil {
+		rallyId = opts.RallyId
+	}
+
+	var bests []StageBest
+	if err := store.DB.Raw(CleanSQL(getStageBestsSQL), rallyId).Scan(&bests).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch best stage results: %w", err)
+	}
+	return bests, nil
+}
+
+//go:embed sql_files/get_stage_positions.sql
+var getStagePositionsSQL string
+
+// GetStagePositions fetches every driver's position on every stage, either for
+// a single rally or, without a rally ID, for all rallies.
+func GetStagePositions(store *Store, opts *QueryOpts) ([]StagePosition, error) {
+	var rallyId *int64
+	if opts != nil {
+		rallyId = opts.RallyId
+	}
+
+	var positions []StagePosition
+	if err := store.DB.Raw(CleanSQL(getStagePositionsSQL), rallyId).Scan(&positions).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch stage positions: %w", err)
+	}
+	return positions, nil
+}
+
 //go:embed sql_files/get_driver_stages.sql
 var getDriverStagesSQL string
 
@@ -56,9 +102,12 @@ func GetRankedRows(store *Store, opts *QueryOpts) ([]RankedRow, error) {
 	var err error
 
 	if opts.Type != nil {
-		if *opts.Type == DRIVER_CLASS {
+		switch *opts.Type {
+		case DRIVER_CLASS:
 			rows, err = getDriverClassRankings(store, opts)
-		} else {
+		case GROUP_CLASS:
+			rows, err = getGroupRankings(store, opts)
+		default:
 			rows, err = getCarClassRankings(store, opts)
 		}
 	} else {
@@ -111,3 +160,65 @@ func getDriverClassRankings(store *Store, opts *QueryOpts) ([]RankedRow, error)
 
 	return rankings, nil
 }
+
+//go:embed sql_files/get_group_rankings.sql
+var getGroupRankingsSQL string
+
+// groupRankedRow is a ranked row with the RSF car group it was ranked in.
+type groupRankedRow struct {
+	RankedRow
+	CarGroup string
+}
+
+// getGroupRankings ranks the drivers within the RSF car group they drove in.
+// The class IDs of the rows are those of GetGroupClasses.
+func getGroupRankings(store *Store, opts *QueryOpts) ([]RankedRow, error) {
+	groups, err := carGroups(store.DB)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]int64, len(groups))
+	for i, g := range groups {
+		ids[g] = int64(i + 1)
+	}
+
+	var ranked []groupRankedRow
+	if err := store.DB.Raw(CleanSQL(getGroupRankingsSQL), opts.RallyId).Scan(&ranked).Error; err != nil {
+		return nil, err
+	}
+
+	rows := make([]RankedRow, len(ranked))
+	for i, r := range ranked {
+		rows[i] = r.RankedRow
+		rows[i].ClassId = ids[r.CarGroup]
+	}
+	return rows, nil
+}
+
+// GetGroupClasses returns the RSF car groups of the stage results as classes,
+// numbered in the order of their names, for classesType "group".
+func GetGroupClasses(store *Store) (map[int64]Class, error) {
+	groups, err := carGroups(store.DB)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[int64]Class, len(groups))
+	for i, g := range groups {
+		id := int64(i + 1)
+		m[id] = Class{ID: id, Name: g, Slug: parser.Slugify(g), Active: true}
+	}
+	return m, nil
+}
+
+// carGroups returns the RSF car groups of the stage results, ordered by name.
+func carGroups(db *gorm.DB) ([]string, error) {
+	var groups []string
+	if err := db.Model(&RallyStage{}).
+		Where(`"group" <> ''`).
+		Distinct(`"group"`).
+		Order(`"group"`).
+		Pluck(`"group"`, &groups).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch car groups: %w", err)
+	}
+	return groups, nil
+}
@@ -3,21 +3,32 @@
 WITH ranked AS (
   SELECT
     ro.rally_id,
-    ro.user_id,
-    ro.user_name,
+    -- results count for the driver, whatever account or name they used
+    COALESCE(d.user_id, ro.user_id)   AS user_id,
+    COALESCE(d.name,    ro.user_name) AS user_name,
     ro.time3,
+    ro.penalty,
+    ro.super_rally,
     cc.class_id,
     ROW_NUMBER() OVER (
       PARTITION BY ro.rally_id, cc.class_id
-      ORDER BY ro.time3
+      -- drivers without a finishing time go last
+      ORDER BY ro.time3 = 0, ro.time3
     ) AS pos
   FROM rally_overalls ro
   JOIN cars       c  ON c.id     = ro.car_id
   JOIN class_cars cc ON cc.car_id = c.id
+                    -- only rallies within the car's time in the class
+                    AND (cc.from_rally = 0 OR ro.rally_id >= cc.from_rally)
+                    AND (cc.to_rally   = 0 OR ro.rally_id <= cc.to_rally)
+  LEFT JOIN drivers d ON d.id = ro.driver_id
 
-  -- this single WHERE does “no filter” when ? IS NULL,
-  -- or “only rally = ?” when you pass a number
-  WHERE ro.rally_id = COALESCE(?, ro.rally_id)
+  -- this single WHERE does “no filter” when ?1 IS NULL,
+  -- or “only rally = ?1” when you pass a number
+  WHERE ro.rally_id = COALESCE(?1, ro.rally_id)
+    -- archived rallies only show up when asked for explicitly
+    AND (?1 IS NOT NULL
+         OR ro.rally_id NOT IN (SELECT rally_id FROM rallies WHERE archived = 1))
 )
 
 SELECT
@@ -26,6 +37,8 @@ SELECT
   user_id,
   user_name,
   time3,
+  penalty,
+  super_rally,
   pos
 FROM ranked
 ORDER BY rally_id, class_id, pos;
@@ -1,18 +1,31 @@
 WITH driver_classes AS (
-  SELECT
+  -- class members are found through their driver, so renamed and merged
+  -- accounts stay in the class
+  SELECT DISTINCT
     ro.rally_id,
-    ro.user_id,
-    ro.user_name,
+    d.user_id,
+    d.name AS user_name,
     ro.time3,
+    ro.penalty,
+    ro.super_rally,
     cd.class_id
   FROM rally_overalls ro
-  JOIN class_drivers cd ON cd.user_id = ro.user_id
-  WHERE (?1 IS NULL) OR (ro.rally_id = ?1)
+  JOIN drivers d        ON d.id = ro.driver_id
+  JOIN drivers member   ON COALESCE(NULLIF(member.merged_into, 0), member.id) = d.id
+  JOIN class_drivers cd ON cd.user_id = member.user_id
+                       -- only rallies within the driver's time in the class
+                       AND (cd.from_rally = 0 OR ro.rally_id >= cd.from_rally)
+                       AND (cd.to_rally   = 0 OR ro.rally_id <= cd.to_rally)
+  WHERE ((?1 IS NULL) OR (ro.rally_id = ?1))
+    -- archived rallies only show up when asked for explicitly
+    AND (?1 IS NOT NULL
+         OR ro.rally_id NOT IN (SELECT rally_id FROM rallies WHERE archived = 1))
 ),
 ranked AS (
   SELECT
-    dc.rally_id, dc.class_id, dc.user_id, dc.user_name, dc.time3,
-    ROW_NUMBER() OVER (PARTITION BY dc.rally_id, dc.class_id ORDER BY dc.time3) AS pos
+    dc.rally_id, dc.class_id, dc.user_id, dc.user_name, dc.time3, dc.penalty, dc.super_rally,
+    -- drivers without a finishing time go last
+    ROW_NUMBER() OVER (PARTITION BY dc.rally_id, dc.class_id ORDER BY dc.time3 = 0, dc.time3) AS pos
   FROM driver_classes dc
 )
 SELECT
@@ -20,6 +33,9 @@ SELECT
   r.class_id,
   r.user_id,
   r.user_name,
+  r.time3,
+  r.penalty,
+  r.super_rally,
   r.pos
 FROM ranked r
 ORDER BY r.rally_id, r.class_id, r.pos
@@ -2,17 +2,18 @@ WITH
   -- 1) only real finishers (time3>0), compute total_time per stage
   stage_totals AS (
     SELECT
-      stage_num,
-      stage_name,
-      user_name,
-      time3 
-        + penalty 
-        + service_penalty  AS total_time,
-      penalty + service_penalty AS penalty,
-      comments
-    FROM rally_stages
-    WHERE rally_id   = ?1 
-      AND time3      >  0                -- <<< filter out DNF’s
+      rs.stage_num,
+      rs.stage_name,
+      COALESCE(d.name, rs.user_name) AS user_name,  -- the driver's current name
+      rs.time3 
+        + rs.penalty 
+        + rs.service_penalty  AS total_time,
+      rs.penalty + rs.service_penalty AS penalty,
+      rs.comments
+    FROM rally_stages rs
+    LEFT JOIN drivers d ON d.id = rs.driver_id
+    WHERE rs.rally_id   = ?1 
+      AND rs.time3      >  0                -- <<< filter out DNF’s
   ),
 
   -- 2) find the winning total_time per stage (among finishers)
@@ -0,0 +1,42 @@
+WITH entrant_groups AS (
+  -- an entrant's group is the RSF group of their car, as the stage results
+  -- have it
+  SELECT rally_id, user_name, MAX("group") AS car_group
+  FROM rally_stages
+  WHERE "group" <> ''
+  GROUP BY rally_id, user_name
+),
+ranked AS (
+  SELECT
+    ro.rally_id,
+    -- results count for the driver, whatever account or name they used
+    COALESCE(d.user_id, ro.user_id)   AS user_id,
+    COALESCE(d.name,    ro.user_name) AS user_name,
+    ro.time3,
+    ro.penalty,
+    ro.super_rally,
+    eg.car_group,
+    ROW_NUMBER() OVER (
+      PARTITION BY ro.rally_id, eg.car_group
+      -- drivers without a finishing time go last
+      ORDER BY ro.time3 = 0, ro.time3
+    ) AS pos
+  FROM rally_overalls ro
+  JOIN entrant_groups eg ON eg.rally_id = ro.rally_id AND eg.user_name = ro.user_name
+  LEFT JOIN drivers d ON d.id = ro.driver_id
+  WHERE ((?1 IS NULL) OR (ro.rally_id = ?1))
+    -- archived rallies only show up when asked for explicitly
+    AND (?1 IS NOT NULL
+         OR ro.rally_id NOT IN (SELECT rally_id FROM rallies WHERE archived = 1))
+)
+SELECT
+  rally_id,
+  car_group,
+  user_id,
+  user_name,
+  time3,
+  penalty,
+  super_rally,
+  pos
+FROM ranked
+ORDER BY rally_id, car_group, pos
@@ -1,57 +1,91 @@
 -- get_season_summary.sql
 
 WITH
+  -- archived rallies keep their data but do not count towards the season
+  archived AS (
+    SELECT rally_id
+    FROM rallies
+    WHERE archived = 1
+  ),
+
+  -- results count for the driver, whatever account or name they used
+  overalls AS (
+    SELECT
+      ro.*,
+      COALESCE(d.user_id,     ro.user_id)     AS driver_user_id,
+      COALESCE(d.name,        ro.user_name)   AS driver_name,
+      COALESCE(d.nationality, ro.nationality) AS driver_nationality
+    FROM rally_overalls ro
+    LEFT JOIN drivers d ON d.id = ro.driver_id
+    WHERE ro.rally_id NOT IN (SELECT rally_id FROM archived)
+  ),
+
+  stages AS (
+    SELECT
+      rs.*,
+      d.user_id AS driver_user_id
+    FROM rally_stages rs
+    JOIN drivers d ON d.id = rs.driver_id
+    WHERE rs.rally_id NOT IN (SELECT rally_id FROM archived)
+  ),
+
   rally_stats AS (
     SELECT
-      ro.user_name,
-      ro.nationality,
+      ro.driver_user_id,
+      MAX(ro.driver_name)                                     AS user_name,
+      MAX(ro.driver_nationality)                              AS nationality,
       COUNT(DISTINCT ro.rally_id)                             AS rallies_started,
-      SUM(CASE WHEN CAST(ro.position AS INTEGER) = 1 THEN 1 
+      SUM(CASE WHEN CAST(ro.position AS INTEGER) = 1 THEN 1
                ELSE 0 END)                                    AS rally_wins,
-      SUM(CASE WHEN CAST(ro.position AS INTEGER) <= 3 THEN 1 
+      SUM(CASE WHEN CAST(ro.position AS INTEGER) <= 3 THEN 1
                ELSE 0 END)                                    AS podiums,
       MIN(CAST(ro.position AS INTEGER))                       AS best_position,
       AVG(CAST(ro.position AS INTEGER))                       AS average_position
-    FROM rally_overalls ro
-    GROUP BY ro.user_name, ro.nationality
+    FROM overalls ro
+    GROUP BY ro.driver_user_id
   ),
 
   super_rallied AS (
     SELECT
-      rs.user_name,
+      rs.driver_user_id,
       COUNT(*)                                              AS total_super_rallied_stages
-    FROM rally_stages rs
+    FROM stages rs
     WHERE rs.super_rally = 1
-    GROUP BY rs.user_name
+    GROUP BY rs.driver_user_id
   ),
 
   stage_wins AS (
     SELECT
-      rs2.user_name,
+      rs2.driver_user_id,
       COUNT(*)                                              AS stage_wins
-    FROM rally_stages rs2
+    FROM stages rs2
     JOIN (
       SELECT
         rally_id,
         stage_num,
         MIN(time3) AS min_time
       FROM rally_stages
+      WHERE rally_id NOT IN (SELECT rally_id FROM archived)
       GROUP BY rally_id, stage_num
     ) sw ON rs2.rally_id   = sw.rally_id
         AND rs2.stage_num  = sw.stage_num
         AND rs2.time3      = sw.min_time
-    GROUP BY rs2.user_name
+    GROUP BY rs2.driver_user_id
   ),
 
-  -- dynamic mapping: we pass a JSON array like "[10,8,6,5,...]" as the first bind parameter
-  points_map AS (
+  -- points are calculated in Go (tie policies and all) and passed in as a
+  -- JSON array like '[{"rally_id":1,"user_id":7,"user_name":"x","points":32,"dropped":false},...]'
+  awarded AS (
     SELECT
-      CAST(json_each.key   AS INTEGER) + 1    AS position,
-      CAST(json_each.value AS INTEGER)        AS points
+      CAST(json_extract(json_each.value, '$.rally_id') AS INTEGER) AS rally_id,
+      CAST(json_extract(json_each.value, '$.user_id') AS INTEGER)  AS user_id,
+      CAST(json_extract(json_each.value, '$.points') AS INTEGER)   AS points,
+      CAST(json_extract(json_each.value, '$.dropped') AS INTEGER)  AS dropped
     FROM json_each(?)  -- <-- binds your JSON-array string
   )
 
 SELECT
+  rs.driver_user_id AS user_id,
   rs.user_name,
   rs.nationality,
   rs.rallies_started,
@@ -62,14 +96,20 @@ SELECT
   COALESCE(sr.total_super_rallied_stages, 0)   AS total_super_rallied_stages,
   COALESCE(sw.stage_wins,               0)     AS stage_wins,
   COALESCE((
-    SELECT SUM(pm.points)
-    FROM rally_overalls ro2
-    JOIN points_map pm
-      ON CAST(ro2.position AS INTEGER) = pm.position
-    WHERE ro2.user_name = rs.user_name
-  ), 0)                                        AS total_championship_points
+    SELECT SUM(a.points)
+    FROM awarded a
+    WHERE a.user_id = rs.driver_user_id
+      AND a.rally_id NOT IN (SELECT rally_id FROM archived)
+      AND a.dropped = 0
+  ), 0)                                        AS total_championship_points,
+  COALESCE((
+    SELECT SUM(a.points)
+    FROM awarded a
+    WHERE a.user_id = rs.driver_user_id
+      AND a.rally_id NOT IN (SELECT rally_id FROM archived)
+  ), 0)                                        AS gross_championship_points
 
 FROM rally_stats rs
-LEFT JOIN super_rallied sr ON sr.user_name = rs.user_name
-LEFT JOIN stage_wins   sw ON sw.user_name = rs.user_name
+LEFT JOIN super_rallied sr ON sr.driver_user_id = rs.driver_user_id
+LEFT JOIN stage_wins   sw ON sw.driver_user_id = rs.driver_user_id
 ORDER BY rs.user_name;
@@ -0,0 +1,28 @@
+-- get_stage_positions.sql
+-- every finisher's position on every stage, used for stage bonus points
+
+WITH
+  -- only real finishers (time3>0), compute total_time per stage
+  stage_totals AS (
+    SELECT
+      rs.rally_id,
+      rs.stage_num,
+      COALESCE(d.name, rs.user_name) AS user_name,  -- the driver's current name
+      rs.time3 + rs.penalty + rs.service_penalty AS total_time
+    FROM rally_stages rs
+    LEFT JOIN drivers d ON d.id = rs.driver_id
+    WHERE rs.time3 > 0
+      AND ((?1 IS NULL) OR (rs.rally_id = ?1))
+  )
+
+-- rank every finisher on each stage, equal times share the position
+SELECT
+  rally_id,
+  stage_num,
+  user_name,
+  RANK() OVER (
+    PARTITION BY rally_id, stage_num
+    ORDER BY total_time ASC
+  ) AS position
+FROM stage_totals
+ORDER BY rally_id, stage_num, position
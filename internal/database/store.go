@@ -1,9 +1,7 @@
 package database
 
 import (
-	"encoding/json"
 	"fmt"
-	"os"
 	"path/filepath"
 
 	"github.com/MorganPeterson/octanepoints/internal/configuration"
@@ -20,12 +18,14 @@ type CarsWrapper struct {
 
 // Store wraps your GORM DB instance.
 type Store struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	config *configuration.Config
 }
 
 // NewStore opens (or creates) the SQLite file at path, applies
-// connection settings, and runs migrations.
-func NewStore(path string) (*Store, error) {
+// connection settings, and runs migrations. The configuration is used to
+// seed the classes and their members.
+func NewStore(path string, config *configuration.Config) (*Store, error) {
 	// Open with a bit of GORM logging enabled; adjust logger level if needed.
 	p := filepath.ToSlash(path)
 	gormDB, err := gorm.Open(
@@ -46,7 +46,7 @@ func NewStore(path string) (*Store, error) {
 	sqlDB.SetMaxOpenConns(1)
 	sqlDB.SetMaxIdleConns(1)
 
-	store := &Store{DB: gormDB}
+	store := &Store{DB: gormDB, config: config}
 	if err := store.Migrate(); err != nil {
 		return nil, fmt.Errorf("automigrate failed: %w", err)
 	}
@@ -56,6 +56,17 @@ func NewStore(path string) (*Store, error) {
 
 // Migrate runs AutoMigrate on all your models.
 func (s *Store) Migrate() error {
+	// class rosters are rebuilt from the configuration below, so tables from
+	// before membership ranges, whose keys changed, are simply dropped
+	for _, model := range []any{&ClassMember{}, &ClassDriver{}} {
+		m := s.DB.Migrator()
+		if m.HasTable(model) && !m.HasColumn(model, "FromRally") {
+			if err := m.DropTable(model); err != nil {
+				return fmt.Errorf("dropping old class rosters: %w", err)
+			}
+		}
+	}
+
 	if err := s.DB.AutoMigrate(
 		&RallyOverall{},
 		&RallyStage{},
@@ -63,7 +74,12 @@ func (s *Store) Migrate() error {
 		&Cars{},
 		&Class{},
 		&ClassCar{},
+		&ClassMember{},
 		&ClassDriver{},
+		&Driver{},
+		&DriverName{},
+		&Team{},
+		&TeamDriver{},
 	); err != nil {
 		return fmt.Errorf("failed to migrate database: %w", err)
 	}
@@ -78,11 +94,19 @@ func (s *Store) Migrate() error {
 		}
 	}
 
-	err := seedClassesAndMembers(s.DB, configuration.MustLoad("config.toml"))
+	if err := linkAllDrivers(s.DB); err != nil {
+		return fmt.Errorf("linking drivers: %w", err)
+	}
+
+	err := seedClassesAndMembers(s.DB, s.config)
 	if err != nil {
 		return fmt.Errorf("seeding classes and members: %w", err)
 	}
 
+	if err := seedTeamsAndDrivers(s.DB, s.config); err != nil {
+		return fmt.Errorf("seeding teams and drivers: %w", err)
+	}
+
 	return nil
 }
 
@@ -115,78 +139,94 @@ func seedClassesAndMembers(db *gorm.DB, config *configuration.Config) error {
 			return fmt.Errorf("upserting classes: %w", err)
 		}
 
-		// Build a map[slug]classID & a map[name]slug
+		// map the configured classes to their IDs
 		var dbCls []Class
 		slugs := make([]string, 0, len(config.Classes))
-		nameToSlug := make(map[string]string, len(config.Classes))
 		for _, c := range config.Classes {
-			slug := parser.Slugify(c.Name)
-			nameToSlug[c.Name] = slug
-			slugs = append(slugs, slug)
+			slugs = append(slugs, parser.Slugify(c.Name))
 		}
-
 		if err := tx.Where("slug IN ?", slugs).Find(&dbCls).Error; err != nil {
 			return fmt.Errorf("finding classes: %w", err)
 		}
-
 		slugToID := make(map[string]int64, len(dbCls))
 		for _, c := range dbCls {
-			slugToID[nameToSlug[c.Name]] = c.ID
+			slugToID[c.Slug] = c.ID
 		}
 
-		// for each class, upsert ClassCar rows
-		var catJoins []ClassCar
-		categories := []string{}
-		for _, c := range config.Classes {
-			categories = append(categories, c.Categories...) // collect categories
+		if err := resolveClassCars(tx, config.Classes); err != nil {
+			return err
 		}
 
-		// find all cars in that category
-		var cars []Cars
-		if err := tx.Where("category IN ?", categories).Find(&cars).Error; err != nil {
-			return fmt.Errorf("finding cars: %w", err)
+		// replace the rosters; they are matched to drivers by resolveClassDrivers
+		if err := tx.Where("1 = 1").Delete(&ClassMember{}).Error; err != nil {
+			return fmt.Errorf("clearing class rosters: %w", err)
 		}
-
-		for _, car := range cars {
-			catJoins = append(catJoins, ClassCar{
-				ClassID: slugToID[nameToSlug[car.Category]],
-				CarID:   car.ID,
-			})
+		var members []ClassMember
+		for _, c := range config.Classes {
+			cid := slugToID[parser.Slugify(c.Name)]
+			for _, uname := range c.Drivers {
+				members = append(members, ClassMember{ClassID: cid, UserName: uname})
+			}
+			for _, id := range c.DriverIds {
+				members = append(members, ClassMember{ClassID: cid, UserId: id})
+			}
+			for _, m := range c.Members {
+				if m.Driver != "" || m.UserId != 0 {
+					members = append(members, ClassMember{
+						ClassID:   cid,
+						UserName:  m.Driver,
+						UserId:    m.UserId,
+						FromRally: m.From,
+						ToRally:   m.To,
+					})
+				}
+			}
 		}
-		if len(catJoins) > 0 {
-			if err := tx.Clauses(clause.OnConflict{
-				Columns:   []clause.Column{{Name: "class_id"}, {Name: "car_id"}},
-				DoNothing: true,
-			}).Create(&catJoins).Error; err != nil {
-				return fmt.Errorf("upserting class-car joins: %w", err)
+		if len(members) > 0 {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&members).Error; err != nil {
+				return fmt.Errorf("storing class rosters: %w", err)
 			}
 		}
 
-		// upsert ClassDriver rows
-		var drvJoins []ClassDriver
-		for _, c := range config.Classes {
-			cid := slugToID[nameToSlug[c.Name]]
-			for _, uname := range c.Drivers {
-				// look up UserId from your last import (RallyOverall table)
-				var ro RallyOverall
-				if err := tx.Select("user_id").
-					Where("user_name = ?", uname).
-					Order("rally_id DESC").
-					First(&ro).Error; err != nil {
-					continue // skip if unknown driver
+		return resolveClassDrivers(tx)
+	})
+}
+
+// seedTeamsAndDrivers upserts the teams from the configuration and replaces
+// their rosters, so drivers removed from a team in the config leave it.
+func seedTeamsAndDrivers(db *gorm.DB, config *configuration.Config) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if len(config.Teams) > 0 {
+			teams := make([]Team, len(config.Teams))
+			for i, t := range config.Teams {
+				teams[i] = Team{
+					Name:       t.Name,
+					Slug:       parser.Slugify(t.Name),
+					MaxScorers: t.MaxScorers,
 				}
-				drvJoins = append(drvJoins, ClassDriver{
-					ClassID: cid,
-					UserId:  ro.UserId,
-				})
 			}
-		}
-		if len(drvJoins) > 0 {
 			if err := tx.Clauses(clause.OnConflict{
-				Columns:   []clause.Column{{Name: "class_id"}, {Name: "user_id"}},
-				DoNothing: true,
-			}).Create(&drvJoins).Error; err != nil {
-				return fmt.Errorf("upserting class-driver joins: %w", err)
+				Columns:   []clause.Column{{Name: "slug"}},
+				DoUpdates: clause.AssignmentColumns([]string{"name", "max_scorers"}),
+			}).Create(&teams).Error; err != nil {
+				return fmt.Errorf("upserting teams: %w", err)
+			}
+		}
+
+		if err := tx.Where("1 = 1").Delete(&TeamDriver{}).Error; err != nil {
+			return fmt.Errorf("clearing team rosters: %w", err)
+		}
+
+		for _, t := range config.Teams {
+			var team Team
+			if err := tx.Where("slug = ?", parser.Slugify(t.Name)).First(&team).Error; err != nil {
+				return fmt.Errorf("finding team %q: %w", t.Name, err)
+			}
+
+			for _, uname := range t.Drivers {
+				if err := tx.Create(&TeamDriver{TeamID: team.ID, UserName: uname}).Error; err != nil {
+					return fmt.Errorf("adding %q to team %q: %w", uname, t.Name, err)
+				}
 			}
 		}
 		return nil
@@ -196,26 +236,14 @@ func seedClassesAndMembers(db *gorm.DB, config *configuration.Config) error {
 // seedFromJSON reads a JSON file and uses that data to seed the Cars and Class
 // related tables. It assumes the JSON structure matches the Cars model.
 func seedCarsAndClasses(db *gorm.DB, path string) error {
-	raw, err := os.ReadFile(path)
+	cars, err := readCarsFile(path)
 	if err != nil {
 		return err
 	}
-
-	var wrapper CarsWrapper
-	if err := json.Unmarshal(raw, &wrapper); err != nil {
-		return err
-	}
-	if len(wrapper.Cars) == 0 {
+	if len(cars) == 0 {
 		return nil
 	}
-
-	// slugify car names and ensure they are unique
-	for i := range wrapper.Cars {
-		wrapper.Cars[i].Slug = parser.Slugify(wrapper.Cars[i].Brand + " " + wrapper.Cars[i].Model)
-		if wrapper.Cars[i].Slug == "" {
-			return fmt.Errorf("car slug is empty for car: %s %s", wrapper.Cars[i].Brand, wrapper.Cars[i].Model)
-		}
-	}
+	wrapper := CarsWrapper{Cars: cars}
 
 	return db.Transaction(func(tx *gorm.DB) error {
 		// 1) Insert cars (if empty)
@@ -0,0 +1,112 @@
+package grab
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/MorganPeterson/octanepoints/internal/configuration"
+)
+
+// Outcomes of grabbing a rally in a batch.
+const (
+	Succeeded = "succeeded"
+	Failed    = "failed"
+	Skipped   = "skipped" // the results were downloaded before
+)
+
+// BatchResult is the outcome of grabbing one rally of a batch.
+type BatchResult struct {
+	Id     int64
+	Status string // Succeeded, Failed or Skipped
+	Err    error  // why the rally failed
+}
+
+// BatchOptions control how a batch of rallies is grabbed.
+type BatchOptions struct {
+	Force         bool // download rallies again even when their files exist
+	ForceTemplate bool // replace the description TOML instead of merging into it
+	Workers       int  // rallies downloaded at the same time, 0 uses download.workers
+	Progress      func(done, total int, r BatchResult)
+}
+
+// Downloaded reports whether both result files of a rally are on disk.
+func Downloaded(id int64, config *configuration.Config) bool {
+	for _, path := range []string{config.StageFile(id), config.OverallFile(id)} {
+		if _, err := os.Stat(path); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// GrabAll grabs many rallies, a few at a time. Rallies that were downloaded
+// before are skipped unless opts.Force is set. Starting two downloads is
+// spaced by download.delaySeconds so RSF isn't flooded with requests. A failed
+// rally doesn't stop the others. The results are in the order of ids.
+func GrabAll(ctx context.Context, ids []int64, opts BatchOptions, config *configuration.Config) ([]BatchResult, error) {
+	c, err := newClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = int(config.Download.Workers)
+	}
+	delay := time.Duration(*config.Download.DelaySeconds) * time.Second
+
+	results := make([]BatchResult, len(ids))
+	var mu sync.Mutex
+	done := 0
+	finish := func(i int, r BatchResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		results[i] = r
+		done++
+		if opts.Progress != nil {
+			opts.Progress(done, len(ids), r)
+		}
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				r := BatchResult{Id: ids[i], Status: Succeeded}
+				if err := grab(ctx, c, ids[i], opts.ForceTemplate, config); err != nil {
+					r.Status, r.Err = Failed, err
+				}
+				finish(i, r)
+			}
+		}()
+	}
+
+	started := 0
+	for i, id := range ids {
+		if !opts.Force && Downloaded(id, config) {
+			finish(i, BatchResult{Id: id, Status: Skipped})
+			continue
+		}
+		if ctx.Err() != nil {
+			finish(i, BatchResult{Id: id, Status: Failed, Err: ctx.Err()})
+			continue
+		}
+		if started > 0 && delay > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(delay):
+			}
+		}
+		started++
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results, nil
+}
@@ -0,0 +1,94 @@
+package grab
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/MorganPeterson/octanepoints/internal/configuration"
+)
+
+const stageCsv = "SS;Stage name;Nationality;User name;Real name;Group;Car name;time1;time2;time3;Finish realtime\n"
+
+func TestGrabAll(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("rally_id") == "2" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.URL.Path {
+		case "/stages":
+			w.Write([]byte(stageCsv))
+		case "/overall":
+			w.Write([]byte(overallCsv))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	var none int64
+	config := &configuration.Config{
+		General: configuration.General{Directory: t.TempDir()},
+		Download: configuration.Download{
+			RallyCSVURLTmpl:     srv.URL + "/stages?rally_id=%d",
+			RallyCSVOverallTmpl: srv.URL + "/overall?rally_id=%d",
+			Directory:           "rallies",
+			StageFileName:       "table.csv",
+			OverallFileName:     "All_table.csv",
+			Delimiter:           ";",
+			TimeoutSeconds:      5,
+			Retries:             &none,
+			Workers:             2,
+			DelaySeconds:        &none,
+			UserAgent:           "test",
+		},
+	}
+
+	// rally 3 was downloaded before
+	for _, path := range []string{config.StageFile(3), config.OverallFile(3)} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("old"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var progress []int
+	opts := BatchOptions{Progress: func(done, total int, r BatchResult) { progress = append(progress, done) }}
+	results, err := GrabAll(context.Background(), []int64{1, 2, 3}, opts, config)
+	if err != nil {
+		t.Fatalf("GrabAll: %v", err)
+	}
+
+	var got []string
+	for _, r := range results {
+		got = append(got, r.Status)
+	}
+	if want := []string{Succeeded, Failed, Skipped}; !reflect.DeepEqual(got, want) {
+		t.Errorf("statuses = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(progress, []int{1, 2, 3}) {
+		t.Errorf("progress = %v, want [1 2 3]", progress)
+	}
+	if !Downloaded(1, config) {
+		t.Error("rally 1 files are missing")
+	}
+	if b, _ := os.ReadFile(config.OverallFile(3)); string(b) != "old" {
+		t.Errorf("skipped rally 3 was downloaded again")
+	}
+
+	// forcing downloads rally 3 again
+	results, err = GrabAll(context.Background(), []int64{3}, BatchOptions{Force: true}, config)
+	if err != nil || results[0].Status != Succeeded {
+		t.Fatalf("forced GrabAll = %+v, %v", results, err)
+	}
+	if b, _ := os.ReadFile(config.OverallFile(3)); string(b) != overallCsv {
+		t.Errorf("forced rally 3 = %q, want %q", b, overallCsv)
+	}
+}
@@ -0,0 +1,187 @@
+package grab
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/MorganPeterson/octanepoints/internal/configuration"
+	"github.com/MorganPeterson/octanepoints/internal/parser"
+)
+
+// client downloads pages and result files from RSF.
+type client struct {
+	http      *http.Client
+	retries   int64
+	wait      time.Duration
+	userAgent string
+	delimiter string
+	aliases   map[string][]string // [download.columns]
+}
+
+// statusError is a response with a status code other than 2xx.
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("bad status code %d: %s", e.code, e.body)
+}
+
+// newClient creates a client from the [download] section of the config.
+func newClient(config *configuration.Config) (*client, error) {
+	proxy := http.ProxyFromEnvironment
+	if config.Download.Proxy != "" {
+		u, err := url.Parse(config.Download.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid download.proxy %q: %w", config.Download.Proxy, err)
+		}
+		proxy = http.ProxyURL(u)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+
+	return &client{
+		http: &http.Client{
+			Transport: transport,
+			Timeout:   time.Duration(config.Download.TimeoutSeconds) * time.Second,
+		},
+		retries:   *config.Download.Retries,
+		wait:      time.Duration(config.Download.RetryWaitSeconds) * time.Second,
+		userAgent: config.Download.UserAgent,
+		delimiter: config.Download.Delimiter,
+		aliases:   config.Download.Columns,
+	}, nil
+}
+
+// get requests the specified URL and returns the response body. Failed
+// requests are retried with a growing wait in between. When a retry follows a
+// body that was cut short, the rest of the body is requested with a range.
+func (c *client) get(ctx context.Context, rawUrl string) ([]byte, error) {
+	var body []byte
+	wait := c.wait
+
+	for attempt := int64(0); ; attempt++ {
+		var err error
+		body, err = c.try(ctx, rawUrl, body)
+		if err == nil {
+			return body, nil
+		}
+		if attempt >= c.retries || !retryable(err) {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// try makes a single request. partial is the body read by an earlier attempt
+// that failed part way; what was read is returned along with any error.
+func (c *client) try(ctx context.Context, rawUrl string, partial []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	req.Header.Set("Accept", "*/*")
+	if len(partial) > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", len(partial)))
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return partial, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && len(partial) > 0:
+		// resuming, keep what we have
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		partial = nil
+	default:
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return partial, &statusError{code: resp.StatusCode, body: strings.TrimSpace(string(b))}
+	}
+
+	buf := bytes.NewBuffer(partial)
+	if _, err := io.Copy(buf, resp.Body); err != nil {
+		return buf.Bytes(), fmt.Errorf("read response body: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// retryable reports whether a failed request is worth trying again: network
+// errors, server errors and rate limiting are, other client errors aren't.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code >= 500 || se.code == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// download fetches a result CSV and saves it to outPath. The header of the
+// body must hold the required columns, otherwise the file already at outPath
+// is left alone. The file is written to a temporary file first and renamed
+// into place, so a failed download never leaves half a file behind.
+func (c *client) download(ctx context.Context, rawUrl, outPath string, columns []parser.Column) error {
+	body, err := c.get(ctx, rawUrl)
+	if err != nil {
+		return err
+	}
+	if err := checkCsv(body, columns, c.delimiter, c.aliases); err != nil {
+		return fmt.Errorf("%s: %w", rawUrl, err)
+	}
+
+	return writeFileAtomic(outPath, body)
+}
+
+// checkCsv makes sure body looks like a result CSV whose header holds the
+// required columns, by name or by one of their aliases. This tells the
+// results apart from the HTML error pages RSF sometimes serves with a 200.
+func checkCsv(body []byte, columns []parser.Column, delimiter string, aliases map[string][]string) error {
+	body = bytes.TrimPrefix(body, []byte("\ufeff"))
+	line, _, _ := bytes.Cut(body, []byte("\n"))
+	first := strings.TrimSpace(string(line))
+
+	if first == "" {
+		return errors.New("response is empty")
+	}
+	if strings.HasPrefix(first, "<") {
+		return errors.New("response is an HTML page, not a CSV file")
+	}
+	if len(delimiter) != 1 {
+		return errors.New("delimiter is not set in the configuration")
+	}
+
+	reader := csv.NewReader(bytes.NewReader(body))
+	reader.Comma = rune(delimiter[0])
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("reading CSV header: %w", err)
+	}
+	if _, err := parser.MapColumns(header, columns, aliases); err != nil {
+		return fmt.Errorf("unexpected CSV header: %w", err)
+	}
+	return nil
+}
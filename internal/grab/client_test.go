@@ -0,0 +1,116 @@
+package grab
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MorganPeterson/octanepoints/internal/parser"
+)
+
+const overallCsv = "#;userid;user_name;real_name;nationality;car;time3;super_rally;penalty\n" +
+	"1;104;Dave;Dave D;DE;Hyundai i20 R5;10:30.148;0;0\n"
+
+// testClient is a client that retries quickly.
+func testClient(t *testing.T) *client {
+	t.Helper()
+	return &client{
+		http:      &http.Client{Timeout: 5 * time.Second},
+		retries:   2,
+		wait:      time.Millisecond,
+		userAgent: "test",
+		delimiter: ";",
+	}
+}
+
+func TestDownloadRetries(t *testing.T) {
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(overallCsv))
+	}))
+	t.Cleanup(srv.Close)
+
+	out := filepath.Join(t.TempDir(), "All_table.csv")
+	if err := testClient(t).download(context.Background(), srv.URL, out, parser.OverallColumns); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("requests = %d, want 3", n)
+	}
+	if b, _ := os.ReadFile(out); string(b) != overallCsv {
+		t.Errorf("saved file = %q, want %q", b, overallCsv)
+	}
+}
+
+func TestDownloadNoRetryOnNotFound(t *testing.T) {
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	out := filepath.Join(t.TempDir(), "All_table.csv")
+	if err := testClient(t).download(context.Background(), srv.URL, out, parser.OverallColumns); err == nil {
+		t.Fatal("download succeeded for a missing file")
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("requests = %d, want 1", n)
+	}
+}
+
+func TestDownloadRejectsHTML(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<!DOCTYPE html><html><body>Rally not found</body></html>"))
+	}))
+	t.Cleanup(srv.Close)
+
+	out := filepath.Join(t.TempDir(), "All_table.csv")
+	if err := os.WriteFile(out, []byte(overallCsv), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := testClient(t).download(context.Background(), srv.URL, out, parser.OverallColumns); err == nil {
+		t.Fatal("download accepted an HTML page")
+	}
+	if b, _ := os.ReadFile(out); string(b) != overallCsv {
+		t.Errorf("existing file was changed to %q", b)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(out)); len(entries) != 1 {
+		t.Errorf("download left %d files behind, want 1", len(entries))
+	}
+}
+
+func TestCheckCsv(t *testing.T) {
+	aliases := map[string][]string{"Stage name": {"Stage"}}
+	tests := []struct {
+		name string
+		body string
+		ok   bool
+	}{
+		{"stage header", stageCsv + "1;Alpha;FI\n", true},
+		{"byte order mark", "\ufeff" + strings.ReplaceAll(stageCsv, "\n", "\r\n"), true},
+		{"reordered", "Stage name;SS;Nationality;User name;Real name;Group;Car name;time1;time2;time3;Finish realtime\n", true},
+		{"alias and case", "ss;Stage;Nationality;User name;Real name;Group;Car name;time1;time2;time3;Finish realtime\n", true},
+		{"quoted", `"SS";"Stage name";"Nationality";"User name";"Real name";"Group";"Car name";"time1";"time2";"time3";"Finish realtime"` + "\n", true},
+		{"wrong file", overallCsv, false},
+		{"empty", "", false},
+		{"html", "<html><body>error</body></html>", false},
+	}
+	for _, tt := range tests {
+		err := checkCsv([]byte(tt.body), parser.StageColumns, ";", aliases)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: checkCsv error = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
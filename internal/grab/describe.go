@@ -0,0 +1,224 @@
+package grab
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MorganPeterson/octanepoints/internal/configuration"
+	"github.com/MorganPeterson/octanepoints/internal/parser"
+)
+
+// Conflict is a field of a rally description the user filled in with a value
+// that differs from the one found in the downloaded results.
+type Conflict struct {
+	Field   string
+	Current string
+	Derived string
+}
+
+// DescribeResult lists what Describe did to a rally description.
+type DescribeResult struct {
+	Path        string              // rally description TOML file
+	Filled      []string            // fields that were filled in
+	Conflicts   []Conflict          // fields left alone because the user set them
+	Diagnostics []parser.Diagnostic // cells of the results files that don't parse
+}
+
+// derived holds the rally details found in the downloaded results.
+type derived struct {
+	started    int64
+	finished   int64
+	stageNames []string
+	carGroups  []string
+	startAt    time.Time
+	endAt      time.Time
+}
+
+// Describe generates or completes the description TOML of a rally from the
+// downloaded stage and overall results. Only fields that are still empty or
+// hold the placeholder written by grab are filled in. Fields the user has
+// already set are kept, and reported as conflicts when the results disagree.
+// Keys of the file this program doesn't know are kept too, and the previous
+// file is saved with a .bak suffix. Cells of the results that don't parse are
+// handled as download.onBadCell says; with "abort" nothing is filled in and
+// the result is returned with the diagnostics and an error.
+func Describe(id int64, config *configuration.Config) (*DescribeResult, error) {
+	d, diags, err := deriveRally(id, config)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &DescribeResult{Path: config.RallyFile(id), Diagnostics: diags}
+	if len(diags) > 0 && config.Download.OnBadCell == configuration.OnBadCellAbort {
+		return res, fmt.Errorf("%d cells of the results don't parse", len(diags))
+	}
+
+	rally := placeholderRally(id)
+	desc, err := configuration.LoadRally(res.Path)
+	switch {
+	case err == nil:
+		rally = desc.Rally
+	case errors.Is(err, fs.ErrNotExist):
+		// no description yet, start from the placeholder
+	default:
+		return nil, err
+	}
+	placeholder := placeholderRally(id)
+
+	fill := func(field string, unset bool, current, value string, apply func()) {
+		switch {
+		case value == "" || current == value:
+		case unset:
+			apply()
+			res.Filled = append(res.Filled, field)
+		default:
+			res.Conflicts = append(res.Conflicts, Conflict{Field: field, Current: current, Derived: value})
+		}
+	}
+
+	fill("started", rally.Started == 0,
+		strconv.FormatInt(rally.Started, 10), strconv.FormatInt(d.started, 10),
+		func() { rally.Started = d.started })
+	fill("finished", rally.Finished == 0,
+		strconv.FormatInt(rally.Finished, 10), strconv.FormatInt(d.finished, 10),
+		func() { rally.Finished = d.finished })
+	fill("numberOfStages", rally.NumberOfStages == 0,
+		strconv.FormatInt(rally.NumberOfStages, 10), strconv.Itoa(len(d.stageNames)),
+		func() { rally.NumberOfStages = int64(len(d.stageNames)) })
+	fill("stageNames", len(rally.StageNames) == 0,
+		strings.Join(rally.StageNames, ", "), strings.Join(d.stageNames, ", "),
+		func() { rally.StageNames = d.stageNames })
+	// car groups are compared in any order
+	groups := rally.CarGroupList()
+	slices.Sort(groups)
+	fill("carGroups", rally.CarGroups == "" || rally.CarGroups == placeholder.CarGroups,
+		strings.Join(groups, ", "), strings.Join(d.carGroups, ", "),
+		func() { rally.CarGroups = strings.Join(d.carGroups, ", ") })
+	if !d.startAt.IsZero() {
+		fill("startAt", rally.StartAt == "" || rally.StartAt == placeholder.StartAt,
+			rally.StartAt, d.startAt.Format("2006-01-02 15:04"),
+			func() { rally.StartAt = d.startAt.Format("2006-01-02 15:04") })
+		fill("endAt", rally.EndAt == "" || rally.EndAt == placeholder.EndAt,
+			rally.EndAt, d.endAt.Format("2006-01-02 15:04"),
+			func() { rally.EndAt = d.endAt.Format("2006-01-02 15:04") })
+	}
+
+	if len(res.Filled) > 0 {
+		if err := updateRallyToml(res.Path, rally, res.Filled); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// deriveRally reads the rally details that can be worked out from the
+// downloaded results, along with the cells that don't parse. Rows with such
+// cells are left out when download.onBadCell is "skip".
+func deriveRally(id int64, config *configuration.Config) (derived, []parser.Diagnostic, error) {
+	var d derived
+	skip := config.Download.OnBadCell == configuration.OnBadCellSkip
+
+	path := config.OverallFile(id)
+	overall, cols, err := readCsv(path, parser.OverallColumns, config)
+	if err != nil {
+		return d, nil, err
+	}
+	op := parser.RowParser{File: path, Cols: cols}
+	for i, row := range overall {
+		op.Row(i+2, row) // line 1 is the header
+		t := op.Duration(parser.OverallTime3)
+		if op.Bad() && skip {
+			continue
+		}
+		d.started++
+		if t > 0 {
+			d.finished++
+		}
+	}
+
+	path = config.StageFile(id)
+	stages, cols, err := readCsv(path, parser.StageColumns, config)
+	if err != nil {
+		return d, op.Diagnostics, err
+	}
+	sp := parser.RowParser{File: path, Cols: cols}
+	names := map[int64]string{}
+	var nums []int64
+	for i, row := range stages {
+		sp.Row(i+2, row)
+		num := sp.Int(parser.StageNum)
+		t := sp.Time(parser.FinishRealTime)
+		if sp.Bad() && skip {
+			continue
+		}
+
+		if _, ok := names[num]; !ok {
+			names[num] = sp.String(parser.StageName)
+			nums = append(nums, num)
+		}
+
+		if g := strings.TrimSpace(sp.String(parser.Group)); g != "" && !slices.Contains(d.carGroups, g) {
+			d.carGroups = append(d.carGroups, g)
+		}
+
+		if !t.IsZero() {
+			if d.startAt.IsZero() || t.Before(d.startAt) {
+				d.startAt = t
+			}
+			if t.After(d.endAt) {
+				d.endAt = t
+			}
+		}
+	}
+
+	slices.Sort(nums)
+	for _, n := range nums {
+		d.stageNames = append(d.stageNames, names[n])
+	}
+	slices.Sort(d.carGroups)
+
+	return d, append(op.Diagnostics, sp.Diagnostics...), nil
+}
+
+// readCsv reads a downloaded results file and resolves its columns by
+// header name. The header row is not returned.
+func readCsv(path string, columns []parser.Column, config *configuration.Config) ([][]string, *parser.ColumnMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening CSV file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	if len(config.Download.Delimiter) != 1 {
+		return nil, nil, fmt.Errorf("delimiter is not set in the configuration")
+	}
+	reader.Comma = rune(config.Download.Delimiter[0])
+	reader.FieldsPerRecord = -1
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading CSV file %s: %w", path, err)
+	}
+	if len(rows) == 0 {
+		return nil, nil, fmt.Errorf("CSV file %s is empty", path)
+	}
+
+	cols, err := parser.MapColumns(rows[0], columns, config.Download.Columns)
+	if err != nil {
+		return nil, nil, fmt.Errorf("CSV file %s: %w", path, err)
+	}
+	for _, row := range rows[1:] {
+		if err := cols.Check(row); err != nil {
+			return nil, nil, fmt.Errorf("CSV file %s: %w", path, err)
+		}
+	}
+	return rows[1:], cols, nil
+}
@@ -0,0 +1,58 @@
+package grab
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MorganPeterson/octanepoints/internal/configuration"
+)
+
+func TestDeriveRallyBadCells(t *testing.T) {
+	config := &configuration.Config{
+		General: configuration.General{Directory: t.TempDir()},
+		Download: configuration.Download{
+			Directory:       "rallies",
+			StageFileName:   "table.csv",
+			OverallFileName: "All_table.csv",
+			Delimiter:       ";",
+		},
+	}
+	files := map[string]string{
+		config.OverallFile(1): "#;userid;user_name;real_name;nationality;car;time3;super_rally;penalty\n" +
+			"1;101;Alice;Alice A;HU;Skoda Fabia R5;10:08.197;0;0\n" +
+			"2;102;Bob;Bob B;HU;Ford Fiesta R5;xx:20;0;0\n",
+		config.StageFile(1): stageCsv +
+			"1;Alpha;HU;Alice;Alice A;Group R5;Skoda Fabia R5;1:00;2:00;3:00.000;2025-06-24 09:00:00\n" +
+			"two;Beta;HU;Alice;Alice A;Group R5;Skoda Fabia R5;1:00;2:00;3:00.000;2025-06-24 10:00:00\n",
+	}
+	for path, data := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config.Download.OnBadCell = configuration.OnBadCellWarn
+	d, diags, err := deriveRally(1, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) != 2 {
+		t.Fatalf("diagnostics = %v, want 2", diags)
+	}
+	if d.started != 2 || d.finished != 1 || len(d.stageNames) != 2 {
+		t.Errorf("warn: started %d, finished %d, stages %v", d.started, d.finished, d.stageNames)
+	}
+
+	config.Download.OnBadCell = configuration.OnBadCellSkip
+	d, _, err = deriveRally(1, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.started != 1 || d.finished != 1 || len(d.stageNames) != 1 {
+		t.Errorf("skip: started %d, finished %d, stages %v", d.started, d.finished, d.stageNames)
+	}
+}
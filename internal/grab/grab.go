@@ -1,22 +1,16 @@
 package grab
 
 import (
-	"bufio"
 	"bytes"
 	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"fmt"
-	"io"
-	"net"
-	"net/http"
-	"net/url"
+	"log"
 	"os"
 	"path/filepath"
-	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/MorganPeterson/octanepoints/internal/configuration"
+	"github.com/MorganPeterson/octanepoints/internal/parser"
 )
 
 type Paths struct {
@@ -25,169 +19,136 @@ type Paths struct {
 	TOML string // path to the TOML file
 }
 
+// Grab downloads the results of a rally and writes its description TOML. A
+// description the user has already filled in is kept, see mergeRallyToml.
 func Grab(ctx context.Context, id int64, config *configuration.Config) error {
+	c, err := newClient(config)
+	if err != nil {
+		return err
+	}
+	return grab(ctx, c, id, false, config)
+}
+
+// grab downloads the results of a rally with c. The description TOML is
+// merged into the one on disk, or replaced when forceTemplate is set.
+func grab(ctx context.Context, c *client, id int64, forceTemplate bool, config *configuration.Config) error {
 	p, err := prepare(id, config)
 	if err != nil {
 		return fmt.Errorf("failed to prepare paths: %w", err)
 	}
 
 	// download the stages results
-	if _, err := stagesDownload(ctx, p, config); err != nil {
+	if _, err := stagesDownload(ctx, c, p, config); err != nil {
 		return fmt.Errorf("failed to download stages results: %w", err)
 	}
 
 	// download the overall results
-	if _, err := overallDownload(ctx, p, config); err != nil {
+	if _, err := overallDownload(ctx, c, p, config); err != nil {
 		return fmt.Errorf("failed to download overall results: %w", err)
 	}
 
-	return nil
-}
-
-// download downloads a file from the specified URL and saves it to outPath.
-func download(ctx context.Context, rawUrl string, outPath string) error {
-	u, err := url.Parse(rawUrl)
-	if err != nil {
-		return err
-	}
-
-	// derive a UTF-8 filename from the URL if caller didn't supply one
-	if outPath == "" {
-		base := filepath.Base(u.Path)
-		if base == "" || base == "/" {
-			base = "downloaded_file"
-		}
-		if u.RawQuery != "" {
-			base += "?" + u.RawQuery
-		}
-		name, err := url.PathUnescape(base) // ensure UTF-8 encoding
+	// fill in the rally description from the summary page if we can
+	rally := placeholderRally(id)
+	var scraped []string
+	if config.Download.RallySummaryTmpl != "" {
+		rawUrl := fmt.Sprintf(config.Download.RallySummaryTmpl, id)
+		summary, keys, err := fetchSummary(ctx, c, rawUrl, id)
 		if err != nil {
-			// fallback
-			name = base
-		}
-		outPath = name
-	}
-
-	host := u.Hostname()
-	port := u.Port()
-	if port == "" {
-		if u.Scheme == "https" {
-			port = "443"
+			log.Printf("Could not read the rally summary page, fill in %s by hand: %v\n", p.TOML, err)
 		} else {
-			port = "80"
+			rally, scraped = summary, keys
 		}
 	}
 
-	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
-	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
-	if err != nil {
-		return fmt.Errorf("dial: %w", err)
-	}
-	defer conn.Close()
-
-	// If HTTPS, wrap with TLS using system CAs.
-	var rw io.ReadWriter = conn
-	if u.Scheme == "https" {
-		pool, err := x509.SystemCertPool()
-		if err != nil {
-			return fmt.Errorf("failed to load system cert pool: %w", err)
-		}
-		tlsConn := tls.Client(conn, &tls.Config{
-			ServerName: host, // SNI + verify
-			RootCAs:    pool,
-		})
-
-		if err := tlsConn.HandshakeContext(ctx); err != nil {
-			return fmt.Errorf("tls handshake: %w", err)
-		}
-
-		rw = tlsConn
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "GET", rawUrl, nil)
-	if err != nil {
-		return fmt.Errorf("new request: %w", err)
-	}
-
-	req.URL.Scheme = ""
-	req.URL.Host = ""
-	req.Header = http.Header{
-		"User-Agent":      []string{"Wget/1.25.0"}, // fake it until you make it
-		"Accept":          []string{"*/*"},
-		"Accept-Encoding": []string{"identity"},
-		"Connection":      []string{"Keep-Alive"},
-	}
-	req.Host = host
-
-	bw := bufio.NewWriter(rw)
-	if err := req.Write(bw); err != nil {
-		return fmt.Errorf("write request: %w", err)
-	}
-	if err := bw.Flush(); err != nil {
-		return fmt.Errorf("flush request: %w", err)
-	}
-
-	// read the response
-	br := bufio.NewReader(rw)
-	resp, err := http.ReadResponse(br, req)
-	if err != nil {
-		return fmt.Errorf("read response: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-		// drain to avoid leaking the connection if re-used
-		io.Copy(io.Discard, resp.Body)
-		return fmt.Errorf(("bad status code %d for %s"), resp.StatusCode, string(b))
+	if forceTemplate {
+		return replaceRallyToml(p.TOML, rally)
 	}
+	return mergeRallyToml(p.TOML, rally, scraped)
+}
 
-	// save body to file
-	outFile, err := os.Create(outPath)
-	if err != nil {
-		return fmt.Errorf("create output file: %w", err)
+// placeholderRally is the rally description written when the details can't
+// be read from the summary page. The user fills it in by hand.
+func placeholderRally(id int64) configuration.Rally {
+	return configuration.Rally{
+		RallyId:          id,
+		Name:             "rally name",
+		Description:      "description of rally",
+		Creator:          "John Doe",
+		DamageLevel:      "reduced",
+		NumberOfLegs:     3,
+		SuperRally:       true,
+		PacenotesOptions: "Normal Pacenotes",
+		Started:          0,
+		Finished:         0,
+		TotalDistance:    0.0,
+		CarGroups:        "Group A8, Group A7",
+		StartAt:          "2025-06-24 08:00",
+		EndAt:            "2025-07-01 08:00",
 	}
-	defer outFile.Close()
+}
 
-	_, err = io.Copy(outFile, resp.Body)
-	if err != nil {
-		return fmt.Errorf("write output file: %w", err)
-	}
+// encodeRallyToml encodes a rally description. Optional fields are only
+// written when they are set.
+func encodeRallyToml(r configuration.Rally) []byte {
+	return encodeToml(map[string]any{"rally": rallyTable(r)})
+}
 
-	return nil
+// rallyTable returns the keys of the [rally] table describing r. Optional
+// fields are left out when they are not set.
+func rallyTable(r configuration.Rally) map[string]any {
+	rally := map[string]any{
+		"rallyId":          r.RallyId,
+		"name":             r.Name,
+		"description":      r.Description,
+		"creator":          r.Creator,
+		"damageLevel":      r.DamageLevel,
+		"numberOfLegs":     r.NumberOfLegs,
+		"superRally":       r.SuperRally,
+		"pacenotesOptions": r.PacenotesOptions,
+		"started":          r.Started,
+		"finished":         r.Finished,
+		"totalDistance":    r.TotalDistance,
+		"carGroups":        r.CarGroups,
+		"startAt":          r.StartAt,
+		"endAt":            r.EndAt,
+	}
+	if r.NumberOfStages > 0 {
+		rally["numberOfStages"] = r.NumberOfStages
+	}
+	if len(r.StageNames) > 0 {
+		rally["stageNames"] = r.StageNames
+	}
+	if r.PowerStage > 0 {
+		rally["powerStage"] = r.PowerStage
+	}
+	if r.PointsMultiplier != 0 {
+		rally["pointsMultiplier"] = r.PointsMultiplier
+	}
+	if len(r.Points) > 0 {
+		rally["points"] = r.Points
+	}
+	if len(r.ClassPoints) > 0 {
+		rally["classPoints"] = r.ClassPoints
+	}
+
+	return rally
 }
 
-func encodeRallyToml() []byte {
+// encodeToml encodes a decoded TOML document.
+func encodeToml(doc map[string]any) []byte {
 	var buf = new(bytes.Buffer)
-	if err := toml.NewEncoder(buf).Encode(map[string]any{
-		"rally": map[string]any{
-			"rallyId":          0,
-			"name":             "rally name",
-			"description":      "description of rally",
-			"creator":          "John Doe",
-			"damageLevel":      "reduced",
-			"numberOfLegs":     3,
-			"superRally":       true,
-			"pacenotesOptions": "Normal Pacenotes",
-			"started":          0,
-			"finished":         0,
-			"totalDistance":    0.0,
-			"carGroups":        "Group A8, Group A7",
-			"startAt":          "2025-06-24 08:00",
-			"endAt":            "2025-07-01 08:00",
-		},
-	}); err != nil {
+	if err := toml.NewEncoder(buf).Encode(doc); err != nil {
 		panic(err)
 	}
 	return buf.Bytes()
 }
 
-func overallDownload(ctx context.Context, p Paths, config *configuration.Config) (string, error) {
+func overallDownload(ctx context.Context, c *client, p Paths, config *configuration.Config) (string, error) {
 	// download the overall results
-	downloadPath := filepath.Join(p.Dir, fmt.Sprintf("%d_%s", p.Id, config.Download.OverallFileName))
+	downloadPath := config.OverallFile(p.Id)
 
 	rawUrl := fmt.Sprintf(config.Download.RallyCSVOverallTmpl, p.Id)
-	if err := download(ctx, rawUrl, downloadPath); err != nil {
+	if err := c.download(ctx, rawUrl, downloadPath, parser.OverallColumns); err != nil {
 		return downloadPath, fmt.Errorf("failed to grab %s: %w", rawUrl, err)
 	}
 
@@ -197,36 +158,22 @@ func overallDownload(ctx context.Context, p Paths, config *configuration.Config)
 func prepare(id int64, config *configuration.Config) (Paths, error) {
 	p := Paths{Id: id}
 
-	// get current directory
-	currentDir, err := os.Getwd()
-	if err != nil {
-		return p, fmt.Errorf("getting current directory: %w", err)
-	}
-
-	p.Dir = filepath.Clean(
-		filepath.Join(
-			currentDir,
-			config.General.Directory,
-			config.Download.Directory,
-			fmt.Sprintf("%d", p.Id)))
+	p.Dir = filepath.Clean(config.RallyDir(p.Id))
 	if err := os.MkdirAll(p.Dir, 0o755); err != nil {
 		return p, fmt.Errorf("failed to create directory %s: %w", p.Dir, err)
 	}
 
-	p.TOML = filepath.Join(p.Dir, fmt.Sprintf("%d.toml", p.Id))
-	if err := os.WriteFile(p.TOML, encodeRallyToml(), 0o644); err != nil {
-		return p, fmt.Errorf("failed to create TOML file %s: %w", p.TOML, err)
-	}
+	p.TOML = config.RallyFile(p.Id)
 
 	return p, nil
 }
 
-func stagesDownload(ctx context.Context, p Paths, config *configuration.Config) (string, error) {
+func stagesDownload(ctx context.Context, c *client, p Paths, config *configuration.Config) (string, error) {
 	// download the stages results
-	downloadPath := filepath.Join(p.Dir, fmt.Sprintf("%d%s", p.Id, config.Download.StageFileName))
+	downloadPath := config.StageFile(p.Id)
 
 	rawUrl := fmt.Sprintf(config.Download.RallyCSVURLTmpl, p.Id)
-	if err := download(ctx, rawUrl, downloadPath); err != nil {
+	if err := c.download(ctx, rawUrl, downloadPath, parser.StageColumns); err != nil {
 		return downloadPath, fmt.Errorf("failed to grab %s: %w", rawUrl, err)
 	}
 
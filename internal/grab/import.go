@@ -0,0 +1,230 @@
+package grab
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+
+	"github.com/MorganPeterson/octanepoints/internal/configuration"
+	"github.com/MorganPeterson/octanepoints/internal/parser"
+)
+
+// ImportSource names the files a rally is imported from: either the stage
+// and overall results files, or a zip archive holding both.
+type ImportSource struct {
+	Stages  string
+	Overall string
+	Zip     string
+}
+
+// ImportResult says what Import found in the imported files.
+type ImportResult struct {
+	Stages  ImportedFile
+	Overall ImportedFile
+}
+
+// ImportedFile describes one imported results file.
+type ImportedFile struct {
+	Source    string // file or zip entry the results came from
+	Encoding  string // "UTF-8" or "Windows-1250"
+	Delimiter rune
+	Rows      int // result rows, without the header
+}
+
+// Import copies results files received from elsewhere into the download
+// directory of a rally, as if they had been grabbed. The delimiter and
+// encoding are detected, the header columns are matched by name and the files
+// are rewritten with the configured delimiter in UTF-8. A rally description
+// TOML is started when there isn't one yet.
+func Import(id int64, src ImportSource, config *configuration.Config) (*ImportResult, error) {
+	files, err := readImportFiles(src)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ImportResult{}
+	var stages, overall []byte
+	for _, f := range files {
+		out, info, kind, err := normalizeCsv(f.name, f.data, config)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case kind == "stages" && stages == nil:
+			stages, res.Stages = out, info
+		case kind == "overall" && overall == nil:
+			overall, res.Overall = out, info
+		default:
+			return nil, fmt.Errorf("%s: more than one %s results file", f.name, kind)
+		}
+	}
+	if stages == nil {
+		return nil, errors.New("no stage results file found")
+	}
+	if overall == nil {
+		return nil, errors.New("no overall results file found")
+	}
+
+	p, err := prepare(id, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare paths: %w", err)
+	}
+	if err := writeFileAtomic(config.StageFile(id), stages); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(config.OverallFile(id), overall); err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(p.TOML); errors.Is(err, fs.ErrNotExist) {
+		if err := writeFileAtomic(p.TOML, encodeRallyToml(placeholderRally(id))); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+type importFile struct {
+	name string
+	data []byte
+}
+
+// readImportFiles reads the files named by src.
+func readImportFiles(src ImportSource) ([]importFile, error) {
+	if src.Zip != "" {
+		if src.Stages != "" || src.Overall != "" {
+			return nil, errors.New("give either a zip archive or the results files, not both")
+		}
+		return readZip(src.Zip)
+	}
+	if src.Stages == "" || src.Overall == "" {
+		return nil, errors.New("both the stage and the overall results files are required")
+	}
+
+	var files []importFile
+	for _, path := range []string{src.Stages, src.Overall} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		files = append(files, importFile{name: path, data: data})
+	}
+	return files, nil
+}
+
+// readZip reads the CSV files in a zip archive.
+func readZip(path string) ([]importFile, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening zip archive %s: %w", path, err)
+	}
+	defer zr.Close()
+
+	var files []importFile
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !strings.EqualFold(filepath.Ext(f.Name), ".csv") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("opening %s in %s: %w", f.Name, path, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s in %s: %w", f.Name, path, err)
+		}
+		files = append(files, importFile{name: path + ":" + f.Name, data: data})
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no CSV files in zip archive %s", path)
+	}
+	return files, nil
+}
+
+// normalizeCsv decodes an imported results file, works out whether it holds
+// stage or overall results by its header and rewrites it with the configured
+// delimiter.
+func normalizeCsv(name string, data []byte, config *configuration.Config) ([]byte, ImportedFile, string, error) {
+	info := ImportedFile{Source: name, Encoding: "UTF-8"}
+
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	if !utf8.Valid(data) {
+		decoded, err := charmap.Windows1250.NewDecoder().Bytes(data)
+		if err != nil {
+			return nil, info, "", fmt.Errorf("%s: decoding Windows-1250: %w", name, err)
+		}
+		data, info.Encoding = decoded, "Windows-1250"
+	}
+
+	info.Delimiter = detectDelimiter(data)
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = info.Delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, info, "", fmt.Errorf("%s: reading CSV: %w", name, err)
+	}
+	if len(rows) == 0 {
+		return nil, info, "", fmt.Errorf("%s: file is empty", name)
+	}
+
+	kind, columns := "stages", parser.StageColumns
+	if looksOverall(rows[0], config) {
+		kind, columns = "overall", parser.OverallColumns
+	}
+	cols, err := parser.MapColumns(rows[0], columns, config.Download.Columns)
+	if err != nil {
+		return nil, info, "", fmt.Errorf("%s: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = rune(config.Download.Delimiter[0])
+	w.Write(rows[0])
+	for _, row := range rows[1:] {
+		if len(row) == 1 && strings.TrimSpace(row[0]) == "" {
+			continue // blank line
+		}
+		if err := cols.Check(row); err != nil {
+			return nil, info, "", fmt.Errorf("%s: %w", name, err)
+		}
+		w.Write(row)
+		info.Rows++
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, info, "", fmt.Errorf("%s: %w", name, err)
+	}
+	return buf.Bytes(), info, kind, nil
+}
+
+// looksOverall reports whether a header is that of the overall results,
+// which have a user ID column the stage results don't.
+func looksOverall(header []string, config *configuration.Config) bool {
+	_, err := parser.MapColumns(header, []parser.Column{{Name: parser.OverallUserId}}, config.Download.Columns)
+	return err == nil
+}
+
+// detectDelimiter picks the delimiter used most in the header line.
+func detectDelimiter(data []byte) rune {
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	best, count := ';', 0
+	for _, d := range []rune{';', ',', '\t'} {
+		if n := bytes.Count(line, []byte(string(d))); n > count {
+			best, count = d, n
+		}
+	}
+	return best
+}
@@ -0,0 +1,40 @@
+package grab
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/MorganPeterson/octanepoints/internal/configuration"
+)
+
+func TestNormalizeCsv(t *testing.T) {
+	config := &configuration.Config{Download: configuration.Download{Delimiter: ";"}}
+
+	// comma separated, columns reordered, "Kőszegi" in Windows-1250
+	data := []byte("penalty,super_rally,time3,car,nationality,real_name,user_name,userid,#\r\n" +
+		"0,0,10:30.148,Hyundai i20 R5,HU,K\xf5szegi,Dave,104,1\r\n")
+
+	out, info, kind, err := normalizeCsv("overall.csv", data, config)
+	if err != nil {
+		t.Fatalf("normalizeCsv: %v", err)
+	}
+	if kind != "overall" || info.Encoding != "Windows-1250" || info.Delimiter != ',' || info.Rows != 1 {
+		t.Errorf("normalizeCsv = %q, %+v", kind, info)
+	}
+
+	want := "penalty;super_rally;time3;car;nationality;real_name;user_name;userid;#\n" +
+		"0;0;10:30.148;Hyundai i20 R5;HU;Kőszegi;Dave;104;1\n"
+	if string(out) != want {
+		t.Errorf("normalizeCsv wrote\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestNormalizeCsvMissingColumns(t *testing.T) {
+	config := &configuration.Config{Download: configuration.Download{Delimiter: ";"}}
+
+	data := []byte("\ufeffSS;Stage name;User name\n1;Alpha;Alice\n")
+	_, _, _, err := normalizeCsv("table.csv", data, config)
+	if err == nil || !strings.Contains(err.Error(), "Car name") {
+		t.Errorf("normalizeCsv error = %v, want missing columns", err)
+	}
+}
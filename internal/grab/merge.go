@@ -0,0 +1,168 @@
+package grab
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/BurntSushi/toml"
+	"github.com/MorganPeterson/octanepoints/internal/configuration"
+)
+
+// placeholderKeys are the [rally] keys whose placeholder values can't be
+// mistaken for real ones, so they are replaced when better values are found.
+// Other keys, e.g. damageLevel = "reduced", keep whatever the file says.
+var placeholderKeys = map[string]bool{
+	"name":        true,
+	"description": true,
+	"creator":     true,
+	"carGroups":   true,
+	"startAt":     true,
+	"endAt":       true,
+}
+
+// mergeRallyToml writes the description of rally to path without losing what
+// the user typed into an existing file. Keys missing from the file are added.
+// Of the keys read from the summary page, scraped, those still holding an
+// empty or placeholder value are replaced. Every other key, including ones
+// this program doesn't know, is kept. The previous file is saved with a .bak
+// suffix when it changes.
+func mergeRallyToml(path string, rally configuration.Rally, scraped []string) error {
+	return editRallyToml(path, rally, func(table map[string]any) bool {
+		return mergeRallyTable(table, rallyTable(rally), rallyTable(placeholderRally(rally.RallyId)), scraped)
+	})
+}
+
+// updateRallyToml sets the [rally] keys of the file at path to the values of
+// rally, keeping every other key. The previous file is saved with a .bak
+// suffix.
+func updateRallyToml(path string, rally configuration.Rally, keys []string) error {
+	return editRallyToml(path, rally, func(table map[string]any) bool {
+		fresh := rallyTable(rally)
+		changed := false
+		for _, key := range keys {
+			if value, ok := fresh[key]; ok {
+				table[key] = value
+				changed = true
+			}
+		}
+		return changed
+	})
+}
+
+// editRallyToml applies edit to the [rally] table of the file at path and
+// writes the file back when edit reports a change, saving the previous file
+// with a .bak suffix. Without a file the description of rally is written.
+func editRallyToml(path string, rally configuration.Rally, edit func(table map[string]any) bool) error {
+	old, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return writeFileAtomic(path, encodeRallyToml(rally))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read TOML file %s: %w", path, err)
+	}
+
+	doc := map[string]any{}
+	if _, err := toml.Decode(string(old), &doc); err != nil {
+		return fmt.Errorf("failed to parse TOML file %s, fix it or grab with --force-template: %w", path, err)
+	}
+	table, ok := doc["rally"].(map[string]any)
+	if !ok {
+		table = map[string]any{}
+		doc["rally"] = table
+	}
+
+	if !edit(table) {
+		return nil
+	}
+
+	if err := os.WriteFile(path+".bak", old, 0o644); err != nil {
+		return fmt.Errorf("failed to back up TOML file %s: %w", path, err)
+	}
+	return writeFileAtomic(path, encodeToml(doc))
+}
+
+// replaceRallyToml writes the description of rally to path, saving the file
+// it replaces with a .bak suffix.
+func replaceRallyToml(path string, rally configuration.Rally) error {
+	old, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := os.WriteFile(path+".bak", old, 0o644); err != nil {
+			return fmt.Errorf("failed to back up TOML file %s: %w", path, err)
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("failed to read TOML file %s: %w", path, err)
+	}
+	return writeFileAtomic(path, encodeRallyToml(rally))
+}
+
+// mergeRallyTable adds the keys of fresh that table is missing, fills in the
+// keys of scraped that table holds unset values for, and reports whether
+// table changed. A key is unset when it is empty or, for placeholderKeys,
+// still holds the value of placeholder, as written when the summary page
+// couldn't be read.
+func mergeRallyTable(table, fresh, placeholder map[string]any, scraped []string) bool {
+	changed := false
+	for key, value := range fresh {
+		current, ok := table[key]
+		switch {
+		case !ok:
+		case !slices.Contains(scraped, key):
+			continue
+		case fmt.Sprint(current) == fmt.Sprint(value):
+			continue
+		case isZero(current):
+		case placeholderKeys[key] && fmt.Sprint(current) == fmt.Sprint(placeholder[key]):
+		default:
+			continue
+		}
+		table[key] = value
+		changed = true
+	}
+	return changed
+}
+
+// isZero reports whether a decoded TOML value is empty.
+func isZero(v any) bool {
+	switch v := v.(type) {
+	case string:
+		return v == ""
+	case int64:
+		return v == 0
+	case float64:
+		return v == 0
+	case []any:
+		return len(v) == 0
+	}
+	return false
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// into place, so path never holds half a file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("save %s: %w", path, err)
+	}
+	return nil
+}
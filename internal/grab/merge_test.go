@@ -0,0 +1,189 @@
+package grab
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MorganPeterson/octanepoints/internal/configuration"
+)
+
+const editedToml = `# typed in by hand
+[rally]
+rallyId = 15234
+name = "Octane Cup Round 3"
+description = "description of rally"
+creator = "Morgan"
+damageLevel = "reduced"
+numberOfLegs = 2
+superRally = false
+pacenotesOptions = "Normal Pacenotes"
+started = 19
+finished = 0
+totalDistance = 151.1
+carGroups = "Group A8, Group A7"
+startAt = "2025-06-24 08:00"
+endAt = "2025-07-01 08:00"
+pointsMultiplier = 2.0
+`
+
+func TestMergeRallyToml(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "15234.toml")
+	if err := os.WriteFile(path, []byte(editedToml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	scraped := placeholderRally(15234)
+	scraped.Name = "Scraped name"
+	scraped.Description = "All Rally, All Day."
+	scraped.NumberOfLegs = 3
+	scraped.Finished = 14
+	scraped.CarGroups = "Super 2000"
+	scraped.NumberOfStages = 6
+	keys := []string{"name", "description", "numberOfLegs", "finished", "carGroups"}
+
+	if err := mergeRallyToml(path, scraped, keys); err != nil {
+		t.Fatalf("mergeRallyToml: %v", err)
+	}
+
+	got, err := configuration.LoadRally(path)
+	if err != nil {
+		t.Fatalf("LoadRally: %v", err)
+	}
+	r := got.Rally
+
+	// typed in values are kept
+	if r.Name != "Octane Cup Round 3" || r.NumberOfLegs != 2 || r.SuperRally || r.PointsMultiplier != 2 {
+		t.Errorf("typed in values changed: %+v", r)
+	}
+	// placeholders, empty values and missing keys are filled in
+	if r.Description != scraped.Description || r.Finished != 14 ||
+		r.CarGroups != scraped.CarGroups || r.NumberOfStages != 6 {
+		t.Errorf("values not filled in: %+v", r)
+	}
+
+	bak, err := os.ReadFile(path + ".bak")
+	if err != nil || string(bak) != editedToml {
+		t.Errorf("backup = %q, %v; want the previous file", bak, err)
+	}
+
+	// nothing left to fill in leaves the file alone
+	before, _ := os.ReadFile(path)
+	if err := mergeRallyToml(path, scraped, keys); err != nil {
+		t.Fatalf("second mergeRallyToml: %v", err)
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(before) {
+		t.Errorf("second merge rewrote the file:\n%s", after)
+	}
+}
+
+func TestReplaceRallyToml(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "15234.toml")
+	if err := os.WriteFile(path, []byte(editedToml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := replaceRallyToml(path, placeholderRally(15234)); err != nil {
+		t.Fatalf("replaceRallyToml: %v", err)
+	}
+
+	b, _ := os.ReadFile(path)
+	if !strings.Contains(string(b), `name = "rally name"`) {
+		t.Errorf("file was not replaced:\n%s", b)
+	}
+	if bak, _ := os.ReadFile(path + ".bak"); string(bak) != editedToml {
+		t.Errorf("backup = %q, want the previous file", bak)
+	}
+}
+
+func TestMergeRallyTomlPlaceholders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "15234.toml")
+	if err := os.WriteFile(path, encodeRallyToml(placeholderRally(15234)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a later grab that could read the summary page
+	scraped := placeholderRally(15234)
+	scraped.Name = "Scraped name"
+	scraped.Creator = "Morgan"
+	scraped.NumberOfLegs = 1
+	scraped.DamageLevel = "realistic"
+	keys := []string{"name", "creator", "numberOfLegs", "damageLevel"}
+
+	if err := mergeRallyToml(path, scraped, keys); err != nil {
+		t.Fatalf("mergeRallyToml: %v", err)
+	}
+
+	got, err := configuration.LoadRally(path)
+	if err != nil {
+		t.Fatalf("LoadRally: %v", err)
+	}
+	r := got.Rally
+	if r.Name != "Scraped name" || r.Creator != "Morgan" {
+		t.Errorf("placeholders not replaced: %+v", r)
+	}
+	// these placeholders could have been typed in
+	if r.NumberOfLegs != 3 || r.DamageLevel != "reduced" {
+		t.Errorf("values that may be typed in were replaced: %+v", r)
+	}
+}
+
+func TestMergeRallyTomlPartialSummary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "15234.toml")
+	edited := strings.Replace(editedToml, `name = "Octane Cup Round 3"`, `name = "rally name"`, 1)
+	if err := os.WriteFile(path, []byte(edited), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := os.ReadFile(filepath.Join("testdata", "summary_partial.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scraped, keys, err := parseSummary(string(page), 15234)
+	if err != nil {
+		t.Fatalf("parseSummary: %v", err)
+	}
+	if err := mergeRallyToml(path, scraped, keys); err != nil {
+		t.Fatalf("mergeRallyToml: %v", err)
+	}
+
+	got, err := configuration.LoadRally(path)
+	if err != nil {
+		t.Fatalf("LoadRally: %v", err)
+	}
+	r := got.Rally
+	if r.Name != "Midweek Sprint" {
+		t.Errorf("name = %q, want the scraped name", r.Name)
+	}
+	// typed in, even where they equal a placeholder, or not on the page
+	if r.DamageLevel != "reduced" || r.NumberOfLegs != 2 || r.SuperRally ||
+		r.Description != "description of rally" || r.Creator != "Morgan" {
+		t.Errorf("typed in values changed: %+v", r)
+	}
+}
+
+func TestUpdateRallyToml(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "15234.toml")
+	edited := editedToml + "organizer = \"Octane Club\"\n"
+	if err := os.WriteFile(path, []byte(edited), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rally := placeholderRally(15234)
+	rally.Finished = 14
+	rally.StageNames = []string{"Alpha", "Beta"}
+	if err := updateRallyToml(path, rally, []string{"finished", "stageNames"}); err != nil {
+		t.Fatalf("updateRallyToml: %v", err)
+	}
+
+	b, _ := os.ReadFile(path)
+	for _, want := range []string{`organizer = "Octane Club"`, `name = "Octane Cup Round 3"`, "finished = 14", `"Alpha"`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("file lacks %s:\n%s", want, b)
+		}
+	}
+	if bak, _ := os.ReadFile(path + ".bak"); string(bak) != edited {
+		t.Errorf("backup = %q, want the previous file", bak)
+	}
+}
@@ -0,0 +1,176 @@
+package grab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MorganPeterson/octanepoints/internal/configuration"
+)
+
+var (
+	cellRe    = regexp.MustCompile(`(?is)<t[dh][^>]*>(.*?)</t[dh]>`)
+	tagRe     = regexp.MustCompile(`(?s)<[^>]*>`)
+	spaceRe   = regexp.MustCompile(`\s+`)
+	intRe     = regexp.MustCompile(`\d+`)
+	floatRe   = regexp.MustCompile(`\d+(?:[.,]\d+)?`)
+	errNoInfo = errors.New("no rally details found on the summary page")
+)
+
+// summaryDateLayouts are the date formats tried for the start and end of a
+// rally, in order.
+var summaryDateLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006.01.02 15:04:05",
+	"2006.01.02 15:04",
+	"2006. 01. 02. 15:04",
+	"2006-01-02",
+}
+
+// summaryField fills a field of the rally description from the value next to
+// a label on the summary page.
+type summaryField struct {
+	key string // [rally] key of the field
+	set func(r *configuration.Rally, v string) error
+}
+
+// summaryFields are the fields read from the summary page by label. Labels
+// are matched lower case without the trailing colon.
+var summaryFields = map[string]summaryField{
+	"name":             {"name", func(r *configuration.Rally, v string) error { r.Name = v; return nil }},
+	"rally name":       {"name", func(r *configuration.Rally, v string) error { r.Name = v; return nil }},
+	"description":      {"description", func(r *configuration.Rally, v string) error { r.Description = v; return nil }},
+	"creator":          {"creator", func(r *configuration.Rally, v string) error { r.Creator = v; return nil }},
+	"created by":       {"creator", func(r *configuration.Rally, v string) error { r.Creator = v; return nil }},
+	"damage":           {"damageLevel", func(r *configuration.Rally, v string) error { r.DamageLevel = strings.ToLower(v); return nil }},
+	"damage level":     {"damageLevel", func(r *configuration.Rally, v string) error { r.DamageLevel = strings.ToLower(v); return nil }},
+	"legs":             {"numberOfLegs", setInt(func(r *configuration.Rally) *int64 { return &r.NumberOfLegs })},
+	"number of legs":   {"numberOfLegs", setInt(func(r *configuration.Rally) *int64 { return &r.NumberOfLegs })},
+	"super rally":      {"superRally", setBool(func(r *configuration.Rally) *bool { return &r.SuperRally })},
+	"superrally":       {"superRally", setBool(func(r *configuration.Rally) *bool { return &r.SuperRally })},
+	"pacenotes":        {"pacenotesOptions", func(r *configuration.Rally, v string) error { r.PacenotesOptions = v; return nil }},
+	"pacenote options": {"pacenotesOptions", func(r *configuration.Rally, v string) error { r.PacenotesOptions = v; return nil }},
+	"started":          {"started", setInt(func(r *configuration.Rally) *int64 { return &r.Started })},
+	"finished":         {"finished", setInt(func(r *configuration.Rally) *int64 { return &r.Finished })},
+	"distance":         {"totalDistance", setDistance},
+	"total distance":   {"totalDistance", setDistance},
+	"car groups":       {"carGroups", func(r *configuration.Rally, v string) error { r.CarGroups = v; return nil }},
+	"cars":             {"carGroups", func(r *configuration.Rally, v string) error { r.CarGroups = v; return nil }},
+	"begins":           {"startAt", setDate(func(r *configuration.Rally) *string { return &r.StartAt })},
+	"start":            {"startAt", setDate(func(r *configuration.Rally) *string { return &r.StartAt })},
+	"ends":             {"endAt", setDate(func(r *configuration.Rally) *string { return &r.EndAt })},
+	"end":              {"endAt", setDate(func(r *configuration.Rally) *string { return &r.EndAt })},
+}
+
+// fetchSummary downloads the rally summary page and extracts the rally
+// description from it, along with the [rally] keys found on the page.
+func fetchSummary(ctx context.Context, c *client, rawUrl string, id int64) (configuration.Rally, []string, error) {
+	body, err := c.get(ctx, rawUrl)
+	if err != nil {
+		return configuration.Rally{}, nil, err
+	}
+	return parseSummary(string(body), id)
+}
+
+// parseSummary extracts the rally description from the HTML of a rally
+// summary page. The page lists the rally details in table rows with a label
+// cell followed by a value cell. Fields that are not on the page keep the
+// placeholder values; the [rally] keys of the fields that are come back in
+// page order.
+func parseSummary(page string, id int64) (configuration.Rally, []string, error) {
+	r := placeholderRally(id)
+
+	var cells []string
+	for _, m := range cellRe.FindAllStringSubmatch(page, -1) {
+		cells = append(cells, cellText(m[1]))
+	}
+
+	var keys []string
+	for i := 0; i+1 < len(cells); i++ {
+		label := strings.ToLower(strings.TrimSpace(strings.TrimSuffix(cells[i], ":")))
+		field, ok := summaryFields[label]
+		if !ok || cells[i+1] == "" {
+			continue
+		}
+		if err := field.set(&r, cells[i+1]); err != nil {
+			return r, keys, fmt.Errorf("summary field %q: %w", label, err)
+		}
+		if !slices.Contains(keys, field.key) {
+			keys = append(keys, field.key)
+		}
+		i++ // the value cell can't be a label
+	}
+
+	if len(keys) == 0 {
+		return r, nil, errNoInfo
+	}
+	return r, keys, nil
+}
+
+// cellText returns the text of a table cell without markup.
+func cellText(s string) string {
+	s = tagRe.ReplaceAllString(s, " ")
+	s = html.UnescapeString(s)
+	return strings.TrimSpace(spaceRe.ReplaceAllString(s, " "))
+}
+
+func setInt(field func(r *configuration.Rally) *int64) func(r *configuration.Rally, v string) error {
+	return func(r *configuration.Rally, v string) error {
+		m := intRe.FindString(v)
+		if m == "" {
+			return fmt.Errorf("no number in %q", v)
+		}
+		n, err := strconv.ParseInt(m, 10, 64)
+		if err != nil {
+			return err
+		}
+		*field(r) = n
+		return nil
+	}
+}
+
+func setBool(field func(r *configuration.Rally) *bool) func(r *configuration.Rally, v string) error {
+	return func(r *configuration.Rally, v string) error {
+		switch strings.ToLower(v) {
+		case "yes", "igen", "true", "on", "allowed", "enabled":
+			*field(r) = true
+		case "no", "nem", "false", "off", "not allowed", "disabled":
+			*field(r) = false
+		default:
+			return fmt.Errorf("unexpected value %q", v)
+		}
+		return nil
+	}
+}
+
+func setDistance(r *configuration.Rally, v string) error {
+	m := floatRe.FindString(v)
+	if m == "" {
+		return fmt.Errorf("no distance in %q", v)
+	}
+	d, err := strconv.ParseFloat(strings.ReplaceAll(m, ",", "."), 64)
+	if err != nil {
+		return err
+	}
+	r.TotalDistance = d
+	return nil
+}
+
+func setDate(field func(r *configuration.Rally) *string) func(r *configuration.Rally, v string) error {
+	return func(r *configuration.Rally, v string) error {
+		for _, layout := range summaryDateLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				*field(r) = t.Format("2006-01-02 15:04")
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown date format %q", v)
+	}
+}
@@ -0,0 +1,93 @@
+package grab
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/MorganPeterson/octanepoints/internal/configuration"
+)
+
+func newSummaryServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetchSummary(t *testing.T) {
+	srv := newSummaryServer(t)
+
+	got, keys, err := fetchSummary(context.Background(), testClient(t), srv.URL+"/summary_15234.html", 15234)
+	if err != nil {
+		t.Fatalf("fetchSummary: %v", err)
+	}
+
+	want := configuration.Rally{
+		RallyId:          15234,
+		Name:             "Octane Cup & Friends - Round 3",
+		Description:      "All Rally, All Day.",
+		Creator:          "Morgan",
+		DamageLevel:      "reduced",
+		NumberOfLegs:     3,
+		SuperRally:       true,
+		PacenotesOptions: "Normal Pacenotes",
+		Started:          19,
+		Finished:         14,
+		TotalDistance:    151.1,
+		CarGroups:        "Super 2000, Group B",
+		StartAt:          "2025-06-24 11:00",
+		EndAt:            "2025-07-01 11:00",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fetchSummary =\n%+v\nwant\n%+v", got, want)
+	}
+	if len(keys) != 13 {
+		t.Errorf("scraped keys = %v, want all 13", keys)
+	}
+}
+
+func TestFetchSummaryPartial(t *testing.T) {
+	srv := newSummaryServer(t)
+
+	got, keys, err := fetchSummary(context.Background(), testClient(t), srv.URL+"/summary_partial.html", 15240)
+	if err != nil {
+		t.Fatalf("fetchSummary: %v", err)
+	}
+
+	if got.Name != "Midweek Sprint" || got.NumberOfLegs != 1 || got.SuperRally {
+		t.Errorf("scraped fields = %q, %d, %v; want %q, 1, false",
+			got.Name, got.NumberOfLegs, got.SuperRally, "Midweek Sprint")
+	}
+
+	if want := []string{"name", "numberOfLegs", "superRally"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("scraped keys = %v, want %v", keys, want)
+	}
+
+	// fields missing from the page keep their placeholders
+	placeholder := placeholderRally(15240)
+	if got.Creator != placeholder.Creator || got.StartAt != placeholder.StartAt {
+		t.Errorf("missing fields = %q, %q; want placeholders %q, %q",
+			got.Creator, got.StartAt, placeholder.Creator, placeholder.StartAt)
+	}
+}
+
+func TestFetchSummaryNoDetails(t *testing.T) {
+	srv := newSummaryServer(t)
+
+	_, _, err := fetchSummary(context.Background(), testClient(t), srv.URL+"/not_found.html", 1)
+	if !errors.Is(err, errNoInfo) {
+		t.Errorf("fetchSummary error = %v, want %v", err, errNoInfo)
+	}
+}
+
+func TestFetchSummaryBadStatus(t *testing.T) {
+	srv := newSummaryServer(t)
+
+	if _, _, err := fetchSummary(context.Background(), testClient(t), srv.URL+"/missing.html", 1); err == nil {
+		t.Error("fetchSummary succeeded for a missing page")
+	}
+}
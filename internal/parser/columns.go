@@ -0,0 +1,189 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Column is a column of a results CSV, named after its RSF header.
+type Column struct {
+	Name     string
+	Optional bool // a missing optional column reads as empty
+}
+
+// The columns of the stage results CSV.
+const (
+	StageNum       = "SS"
+	StageName      = "Stage name"
+	Nationality    = "Nationality"
+	UserName       = "User name"
+	RealName       = "Real name"
+	Group          = "Group"
+	CarName        = "Car name"
+	Time1          = "time1"
+	Time2          = "time2"
+	Time3          = "time3"
+	FinishRealTime = "Finish realtime"
+	Penalty        = "Penalty"
+	ServicePenalty = "Service penalty"
+	SuperRally     = "Super rally"
+	Progress       = "Progress"
+	Comments       = "Comments"
+)
+
+// The columns of the overall results CSV.
+const (
+	OverallPosition    = "#"
+	OverallUserId      = "userid"
+	OverallUserName    = "user_name"
+	OverallRealName    = "real_name"
+	OverallNationality = "nationality"
+	OverallCar         = "car"
+	OverallTime3       = "time3"
+	OverallSuperRally  = "super_rally"
+	OverallPenalty     = "penalty"
+)
+
+// StageColumns are the columns of the stage results CSV, in RSF's order.
+var StageColumns = []Column{
+	{Name: StageNum},
+	{Name: StageName},
+	{Name: Nationality, Optional: true},
+	{Name: UserName},
+	{Name: RealName, Optional: true},
+	{Name: Group},
+	{Name: CarName},
+	{Name: Time1, Optional: true},
+	{Name: Time2, Optional: true},
+	{Name: Time3},
+	{Name: FinishRealTime, Optional: true},
+	{Name: Penalty, Optional: true},
+	{Name: ServicePenalty, Optional: true},
+	{Name: SuperRally, Optional: true},
+	{Name: Progress, Optional: true},
+	{Name: Comments, Optional: true},
+}
+
+// OverallColumns are the columns of the overall results CSV, in RSF's order.
+var OverallColumns = []Column{
+	{Name: OverallPosition},
+	{Name: OverallUserId},
+	{Name: OverallUserName},
+	{Name: OverallRealName, Optional: true},
+	{Name: OverallNationality, Optional: true},
+	{Name: OverallCar},
+	{Name: OverallTime3},
+	{Name: OverallSuperRally, Optional: true},
+	{Name: OverallPenalty, Optional: true},
+}
+
+// ColumnMap finds the fields of a CSV row by column name instead of position.
+type ColumnMap struct {
+	index  map[string]int // column name to position in the row
+	header []string
+	extra  []int // positions of columns that aren't known
+	need   int   // fields a row needs to hold every required column
+}
+
+// MapColumns resolves the known columns in a CSV header. Header names are
+// matched ignoring case and surrounding space, and may also be any of the
+// aliases given for a column name. A missing required column is an error;
+// unknown header columns are kept as extra columns.
+func MapColumns(header []string, columns []Column, aliases map[string][]string) (*ColumnMap, error) {
+	pos := map[string]int{}
+	for i, h := range header {
+		key := normColumn(h)
+		if _, ok := pos[key]; !ok {
+			pos[key] = i
+		}
+	}
+
+	m := &ColumnMap{index: map[string]int{}, header: header}
+	used := map[int]bool{}
+	var missing []string
+	for _, c := range columns {
+		i, ok := findColumn(pos, c.Name, aliases)
+		switch {
+		case ok:
+			m.index[c.Name] = i
+			used[i] = true
+			if !c.Optional && i >= m.need {
+				m.need = i + 1
+			}
+		case !c.Optional:
+			missing = append(missing, c.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing required columns %s in header %q",
+			strings.Join(missing, ", "), strings.Join(header, ","))
+	}
+
+	for i, h := range header {
+		if !used[i] && strings.TrimSpace(h) != "" {
+			m.extra = append(m.extra, i)
+		}
+	}
+	return m, nil
+}
+
+// findColumn returns the position of a column by its name or an alias.
+func findColumn(pos map[string]int, name string, aliases map[string][]string) (int, bool) {
+	if i, ok := pos[normColumn(name)]; ok {
+		return i, true
+	}
+	for key, names := range aliases {
+		if normColumn(key) != normColumn(name) {
+			continue
+		}
+		for _, alias := range names {
+			if i, ok := pos[normColumn(alias)]; ok {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func normColumn(s string) string {
+	return strings.ToLower(strings.TrimSpace(strings.TrimPrefix(s, "\ufeff")))
+}
+
+// Check makes sure a row holds every required column.
+func (m *ColumnMap) Check(row []string) error {
+	if len(row) < m.need {
+		return fmt.Errorf("malformed row (len=%d, want at least %d): %v", len(row), m.need, row)
+	}
+	return nil
+}
+
+// Has reports whether the header has the named column.
+func (m *ColumnMap) Has(name string) bool {
+	_, ok := m.index[name]
+	return ok
+}
+
+// Get returns the named field of a row, or "" when the column is missing.
+func (m *ColumnMap) Get(row []string, name string) string {
+	i, ok := m.index[name]
+	if !ok || i >= len(row) {
+		return ""
+	}
+	return row[i]
+}
+
+// Extra returns the non-empty fields of a row in columns that aren't known,
+// keyed by their header name, or nil when there are none.
+func (m *ColumnMap) Extra(row []string) map[string]string {
+	var extra map[string]string
+	for _, i := range m.extra {
+		if i >= len(row) || row[i] == "" {
+			continue
+		}
+		if extra == nil {
+			extra = map[string]string{}
+		}
+		extra[strings.TrimSpace(m.header[i])] = row[i]
+	}
+	return extra
+}
@@ -0,0 +1,96 @@
+package parser
+
+import (
+	"fmt"
+	"time"
+)
+
+// Diagnostic is a cell of a results file that doesn't parse.
+type Diagnostic struct {
+	File   string
+	Line   int // 1-based line in the file, the header is line 1
+	Column string
+	Value  string
+	Err    error
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d: column %q: %v", d.File, d.Line, d.Column, d.Err)
+}
+
+// RowParser reads typed fields from the rows of a results file, collecting a
+// Diagnostic for every cell that doesn't parse. A cell that doesn't parse
+// reads as zero.
+type RowParser struct {
+	File        string
+	Cols        *ColumnMap
+	Diagnostics []Diagnostic
+
+	line int
+	row  []string
+	bad  bool
+}
+
+// Row starts reading the row at the given 1-based line.
+func (p *RowParser) Row(line int, row []string) {
+	p.line, p.row, p.bad = line, row, false
+}
+
+// Bad reports whether a cell of the current row didn't parse.
+func (p *RowParser) Bad() bool {
+	return p.bad
+}
+
+// String returns a field of the current row as is.
+func (p *RowParser) String(name string) string {
+	return p.Cols.Get(p.row, name)
+}
+
+// Int returns a whole number field of the current row.
+func (p *RowParser) Int(name string) int64 {
+	v, err := ParseInt(p.String(name))
+	p.check(name, err)
+	return v
+}
+
+// Float returns a number field of the current row.
+func (p *RowParser) Float(name string) float64 {
+	v, err := ParseFloat(p.String(name))
+	p.check(name, err)
+	return v
+}
+
+// Bool returns a 0 or 1 flag field of the current row.
+func (p *RowParser) Bool(name string) bool {
+	v, err := ParseBool(p.String(name))
+	p.check(name, err)
+	return v
+}
+
+// Duration returns an "MM:SS.sss" time field of the current row.
+func (p *RowParser) Duration(name string) time.Duration {
+	v, err := ParseHMS(p.String(name))
+	p.check(name, err)
+	return v
+}
+
+// Time returns a finish time field of the current row.
+func (p *RowParser) Time(name string) time.Time {
+	v, err := ParseRealTime(p.String(name))
+	p.check(name, err)
+	return v
+}
+
+func (p *RowParser) check(name string, err error) {
+	if err == nil {
+		return
+	}
+	p.bad = true
+	p.Diagnostics = append(p.Diagnostics, Diagnostic{
+		File:   p.File,
+		Line:   p.line,
+		Column: name,
+		Value:  p.String(name),
+		Err:    err,
+	})
+}
@@ -11,8 +11,13 @@ import (
 
 var slugRegex = regexp.MustCompile(`[^a-z0-9]+`)
 
+// RealTimeLayout is the layout of the finish times in the stage results.
+const RealTimeLayout = "2006-01-02 15:04:05"
+
+// RealTime parses a stage finish time, logging and returning the zero time
+// when it is malformed. Use ParseRealTime to get the error instead.
 func RealTime(val string) time.Time {
-	FinishRealTime, err := time.Parse("2006-01-02 15:04:05", val)
+	FinishRealTime, err := ParseRealTime(val)
 	if err != nil {
 		log.Printf("Error parsing FinishRealTime: %v", err)
 		return time.Time{}
@@ -20,6 +25,15 @@ func RealTime(val string) time.Time {
 	return FinishRealTime
 }
 
+// ParseRealTime parses a stage finish time. An empty value is the zero time.
+func ParseRealTime(val string) (time.Time, error) {
+	val = strings.TrimSpace(val)
+	if val == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(RealTimeLayout, val)
+}
+
 // FmtDuration formats a time.Duration into a string in "MM:SS.sss" or
 // "HH:MM:SS.sss" format.
 func FmtDuration(d time.Duration) string {
@@ -45,64 +59,113 @@ func FmtDuration(d time.Duration) string {
 	return fmt.Sprintf("%d:%05.2f", m, s)
 }
 
-// HMS parses a string in "MM:SS.sss" or "HH:MM:SS.sss" format into a time.Duration.
-// It returns an error if the format is invalid.
+// HMS parses a string in "MM:SS.sss" or "HH:MM:SS.sss" format into a
+// time.Duration, logging and returning 0 when it is malformed. Use ParseHMS to
+// get the error instead.
 func HMS(s string) time.Duration {
-	var h, m int
-	var sec float64
-
-	var duration time.Duration
-	var err error
-
-	switch strings.Count(s, ":") {
-	case 1:
-		// MM:SS.sss
-		_, err = fmt.Sscanf(s, "%d:%f", &m, &sec)
-	case 2:
-		// HH:MM:SS.sss
-		_, err = fmt.Sscanf(s, "%d:%d:%f", &h, &m, &sec)
-	default:
-		log.Printf("invalid time format %q", s)
+	d, err := ParseHMS(s)
+	if err != nil {
+		log.Print(err)
 		return 0
 	}
+	return d
+}
 
-	if err != nil {
-		log.Printf("invalid HMS value %q: %v", s, err)
-		return 0
+// ParseHMS parses a string in "MM:SS.sss" or "HH:MM:SS.sss" format into a
+// time.Duration. An empty value, a driver without a time, is 0.
+func ParseHMS(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
 	}
 
-	duration += time.Duration(h) * time.Hour
-	duration += time.Duration(m) * time.Minute
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 && len(parts) != 3 {
+		return 0, fmt.Errorf("invalid time format %q", s)
+	}
+
+	sec, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil || sec < 0 || sec >= 60 {
+		return 0, fmt.Errorf("invalid HMS value %q: bad seconds", s)
+	}
+	var units []int64
+	for _, p := range parts[:len(parts)-1] {
+		n, err := strconv.ParseInt(p, 10, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid HMS value %q", s)
+		}
+		units = append(units, n)
+	}
+
+	var duration time.Duration
+	if len(units) == 2 {
+		if units[1] >= 60 {
+			return 0, fmt.Errorf("invalid HMS value %q: bad minutes", s)
+		}
+		duration += time.Duration(units[0]) * time.Hour
+	}
+	duration += time.Duration(units[len(units)-1]) * time.Minute
 	duration += time.Duration(sec * float64(time.Second))
 
-	return duration
+	return duration, nil
 }
 
 func StringToBool(s string) bool {
 	return s == "1"
 }
 
+// ParseBool parses a "0" or "1" flag. An empty value is false.
+func ParseBool(s string) (bool, error) {
+	switch strings.TrimSpace(s) {
+	case "", "0":
+		return false, nil
+	case "1":
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid flag %q, want 0 or 1", s)
+}
+
 func StringToFloat(s string) float64 {
-	if s == "" {
+	value, err := ParseFloat(s)
+	if err != nil {
 		return 0
 	}
+	return value
+}
+
+// ParseFloat parses a number. An empty value is 0.
+func ParseFloat(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
 	value, err := strconv.ParseFloat(s, 64)
 	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return value, nil
+}
+
+func StringToInt(s string) int64 {
+	value, err := ParseInt(s)
+	if err != nil {
+		fmt.Printf("Error parsing uint64: %v\n", err)
 		return 0
 	}
 	return value
 }
 
-func StringToInt(s string) int64 {
+// ParseInt parses a whole number. An empty value is 0.
+func ParseInt(s string) (int64, error) {
+	s = strings.TrimSpace(s)
 	if s == "" {
-		return 0
+		return 0, nil
 	}
 	value, err := strconv.ParseInt(s, 10, 64)
 	if err != nil {
-		fmt.Printf("Error parsing uint64: %v\n", err)
-		return 0
+		return 0, fmt.Errorf("invalid whole number %q", s)
 	}
-	return value
+	return value, nil
 }
 
 func Slugify(s string) string {
@@ -25,6 +25,7 @@ type ClassPointsRow struct {
 	Time3    time.Duration
 	Pos      int64
 	Points   int64
+	Note     string // how a tie was settled, if any
 }
 
 type ClassTable struct {
@@ -33,42 +34,62 @@ type ClassTable struct {
 }
 
 type RallySection struct {
-	RallyID int64
-	Classes []ClassTable
+	RallyID   int64
+	Weighting string // how the rally's points differ from the season's, if they do
+	Classes   []ClassTable
 }
 
 type ChampDriverRow struct {
 	UserID      int64
 	UserName    string
-	TotalPoints int64
+	TotalPoints int64 // net points of the counted rounds
+	GrossPoints int64 // points of every round
+	Dropped     []round
 	Pos         int64
 }
 
 type ChampSection struct {
 	ClassName string
+	CountBest int64 // only the best N results count, 0 counts all
 	Rows      []ChampDriverRow
 }
 
+// ClassChangeRow is a driver or car category in a class for some rallies
+// only, e.g. after a mid-season promotion.
+type ClassChangeRow struct {
+	ClassName string
+	Member    string
+	Rallies   string // e.g. "from 15240"
+}
+
 type ClassReportData struct {
 	Rally        RallySection
 	Championship []ChampSection
+	Changes      []ClassChangeRow
 }
 
 // ExportClassReport generates class tables for a single rally (rallyIDStr)
 // AND championship totals across all rallies, then writes class_report.md.
 func ExportClassReport(rallyID int64, store *database.Store, cfg *configuration.Config) error {
 	// 1) Class lookup
-	classLookup, err := database.GetClasses(store)
+	classType := database.ClassTypeFor(cfg.General.ClassesType)
+
+	var classLookup map[int64]database.Class
+	var err error
+	if classType == database.GROUP_CLASS {
+		classLookup, err = database.GetGroupClasses(store)
+	} else {
+		classLookup, err = database.GetClasses(store)
+	}
 	if err != nil {
 		return fmt.Errorf("load classes: %w", err)
 	}
 
-	var classType database.ClassType
-	if cfg.General.ClassesType == "driver" {
-		classType = database.DRIVER_CLASS
-	} else {
-		classType = database.CAR_CLASS
+	rallies, err := database.GetRallies(store)
+	if err != nil {
+		return fmt.Errorf("load rallies: %w", err)
 	}
+	schemes := classSchemes(rallies, cfg)
 
 	// 2) Ranked rows for THIS rally
 	rallyRanked, err := database.GetRankedRows(store, &database.QueryOpts{
@@ -78,12 +99,17 @@ func ExportClassReport(rallyID int64, store *database.Store, cfg *configuration.
 	if err != nil {
 		return fmt.Errorf("fetch rally ranks: %w", err)
 	}
-	rallyWithPts := applyPoints(rallyRanked, cfg.General.ClassPoints)
+	rallyBests, err := loadStageBests(store, &rallyID, cfg)
+	if err != nil {
+		return fmt.Errorf("fetch rally tiebreak data: %w", err)
+	}
+	rallyWithPts := applyPoints(rallyRanked, schemes, rallyBests, cfg)
 
 	// Group into tables
 	rallySection := RallySection{
-		RallyID: rallyID,
-		Classes: groupTables(rallyWithPts, classLookup),
+		RallyID:   rallyID,
+		Weighting: weightingNote(rallies[rallyID], true),
+		Classes:   groupTables(rallyWithPts, classLookup),
 	}
 
 	// 3) Ranked rows for ALL rallies (for championship totals)
@@ -93,13 +119,23 @@ func ExportClassReport(rallyID int64, store *database.Store, cfg *configuration.
 	if err != nil {
 		return fmt.Errorf("fetch all ranks: %w", err)
 	}
-	allWithPts := applyPoints(allRanked, cfg.General.ClassPoints)
-	champ := buildChampionship(allWithPts, classLookup)
+	allBests, err := loadStageBests(store, nil, cfg)
+	if err != nil {
+		return fmt.Errorf("fetch tiebreak data: %w", err)
+	}
+	allWithPts := applyPoints(allRanked, schemes, allBests, cfg)
+	champ := buildChampionship(allWithPts, classLookup, cfg)
+
+	changes, err := database.GetClassChanges(store, classType)
+	if err != nil {
+		return fmt.Errorf("fetch class changes: %w", err)
+	}
 
 	// 4) Export based on configured format
 	data := ClassReportData{
 		Rally:        rallySection,
 		Championship: champ,
+		Changes:      changeRows(changes),
 	}
 
 	// Export based on configured format
@@ -139,12 +175,15 @@ func exportClassCSV(rallyID int64, data ClassReportData, cfg *configuration.Conf
 
 	// Rally results section
 	records = append(records, []string{fmt.Sprintf("Rally %d - Class Results", rallyID)})
+	if data.Rally.Weighting != "" {
+		records = append(records, []string{data.Rally.Weighting})
+	}
 
 	// For each class in the rally
 	for _, class := range data.Rally.Classes {
 		records = append(records, []string{}) // Empty line
 		records = append(records, []string{fmt.Sprintf("Class: %s", class.ClassName)})
-		records = append(records, []string{"Position", "Driver", "Time", "Points"})
+		records = append(records, []string{"Position", "Driver", "Time", "Points", "Notes"})
 
 		for _, row := range class.Rows {
 			records = append(records, []string{
@@ -152,6 +191,7 @@ func exportClassCSV(rallyID int64, data ClassReportData, cfg *configuration.Conf
 				row.UserName,
 				row.Time3.String(),
 				fmt.Sprintf("%d", row.Points),
+				row.Note,
 			})
 		}
 	}
@@ -164,39 +204,82 @@ func exportClassCSV(rallyID int64, data ClassReportData, cfg *configuration.Conf
 	for _, champClass := range data.Championship {
 		records = append(records, []string{}) // Empty line
 		records = append(records, []string{fmt.Sprintf("Class: %s", champClass.ClassName)})
-		records = append(records, []string{"Position", "Driver", "Total Points"})
+		records = append(records, []string{"Position", "Driver", "Total Points", "Gross Points", "Dropped Rounds"})
 
 		for _, row := range champClass.Rows {
 			records = append(records, []string{
 				fmt.Sprintf("%d", row.Pos),
 				row.UserName,
 				fmt.Sprintf("%d", row.TotalPoints),
+				fmt.Sprintf("%d", row.GrossPoints),
+				fmtDropped(row.Dropped),
 			})
 		}
 	}
 
+	// Membership history section
+	if len(data.Changes) > 0 {
+		records = append(records, []string{}) // Empty line
+		records = append(records, []string{}) // Empty line
+		records = append(records, []string{"Class Changes"})
+		records = append(records, []string{"Class", "Member", "Rallies"})
+		for _, c := range data.Changes {
+			records = append(records, []string{c.ClassName, c.Member, c.Rallies})
+		}
+	}
+
 	// create file name and write CSV
 	fileName := fmt.Sprintf("%d_%s.%s", rallyID, cfg.Report.Class.SummaryFilename, "csv")
 
 	return writeCSV(fileName, records, cfg)
 }
 
-func applyPoints(ranked []database.RankedRow, scheme []int64) []ClassPointsRow {
-	out := make([]ClassPointsRow, len(ranked))
-	for i, r := range ranked {
-		pts := int64(0)
-		if r.Pos-1 < int64(len(scheme)) {
-			pts = scheme[r.Pos-1]
+// applyPoints awards class points within every rally and class, using the
+// points table of each rally from schemes. The ranked rows must be ordered by
+// rally, class and time, as the ranking queries return them. Ties are settled
+// with the configured tie policy and the eligibility rules apply as they do
+// for overall points.
+func applyPoints(
+	ranked []database.RankedRow,
+	schemes map[int64][]int64,
+	bests map[stageBestKey]int64,
+	cfg *configuration.Config,
+) []ClassPointsRow {
+	out := make([]ClassPointsRow, 0, len(ranked))
+	for start := 0; start < len(ranked); {
+		end := start + 1
+		for end < len(ranked) &&
+			ranked[end].RallyId == ranked[start].RallyId &&
+			ranked[end].ClassId == ranked[start].ClassId {
+			end++
 		}
-		out[i] = ClassPointsRow{
-			RallyID:  r.RallyId,
-			ClassID:  r.ClassId,
-			UserID:   r.UserId,
-			UserName: r.UserName,
-			Time3:    time.Duration(r.Time3),
-			Pos:      r.Pos,
-			Points:   pts,
+
+		group := ranked[start:end]
+		entries := make([]rankEntry, len(group))
+		for i, r := range group {
+			entries[i] = rankEntry{
+				Name:       r.UserName,
+				Time:       time.Duration(r.Time3),
+				BestStage:  bests[stageBestKey{r.RallyId, r.UserName}],
+				Penalty:    r.Penalty,
+				SuperRally: r.SuperRally,
+			}
+		}
+
+		results := scoreEntries(entries, schemes[group[0].RallyId], cfg.General.TiePolicy, cfg.Scoring.Eligibility)
+		for i, r := range group {
+			out = append(out, ClassPointsRow{
+				RallyID:  r.RallyId,
+				ClassID:  r.ClassId,
+				UserID:   r.UserId,
+				UserName: r.UserName,
+				Time3:    time.Duration(r.Time3),
+				Pos:      results[i].Pos,
+				Points:   results[i].Points,
+				Note:     results[i].Note,
+			})
 		}
+		start = end
 	}
 	return out
 }
@@ -219,12 +302,17 @@ func groupTables(rows []ClassPointsRow, classLookup map[int64]database.Class) []
 	return out
 }
 
-func buildChampionship(rows []ClassPointsRow, classLookup map[int64]database.Class) []ChampSection {
+// buildChampionship totals class points per driver and class. Only the best
+// results count when general.countBest or the class's countBest is set.
+func buildChampionship(
+	rows []ClassPointsRow, classLookup map[int64]database.Class, cfg *configuration.Config,
+) []ChampSection {
 	type key struct {
 		ClassID int64
 		UserID  int64
 	}
 	acc := map[key]*ChampDriverRow{}
+	rounds := map[key][]round{}
 	for _, r := range rows {
 		k := key{r.ClassID, r.UserID}
 		if _, ok := acc[k]; !ok {
@@ -233,27 +321,64 @@ func buildChampionship(rows []ClassPointsRow, classLookup map[int64]database.Cla
 				UserName: r.UserName,
 			}
 		}
-		acc[k].TotalPoints += r.Points
+		acc[k].GrossPoints += r.Points
+		rounds[k] = append(rounds[k], round{RallyId: r.RallyID, Points: r.Points})
 	}
 
 	// regroup by class
 	byClass := map[int64][]ChampDriverRow{}
 	for k, v := range acc {
+		n := cfg.ClassCountBest(classLookup[k.ClassID].Name)
+		v.TotalPoints, v.Dropped = countBest(rounds[k], n)
 		byClass[k.ClassID] = append(byClass[k.ClassID], *v)
 	}
 
 	out := make([]ChampSection, 0, len(byClass))
 	for cid, slice := range byClass {
-		sort.Slice(slice, func(i, j int) bool { return slice[i].TotalPoints > slice[j].TotalPoints })
-		// set positions
+		// ordered like the overall standings, drivers level on points and
+		// gross points share a position
+		sort.Slice(slice, func(i, j int) bool {
+			if slice[i].TotalPoints != slice[j].TotalPoints {
+				return slice[i].TotalPoints > slice[j].TotalPoints
+			}
+			if slice[i].GrossPoints != slice[j].GrossPoints {
+				return slice[i].GrossPoints > slice[j].GrossPoints
+			}
+			if slice[i].UserName != slice[j].UserName {
+				return slice[i].UserName < slice[j].UserName
+			}
+			return slice[i].UserID < slice[j].UserID
+		})
 		for i := range slice {
 			slice[i].Pos = int64(i + 1)
+			if i > 0 && slice[i].TotalPoints == slice[i-1].TotalPoints && slice[i].GrossPoints == slice[i-1].GrossPoints {
+				slice[i].Pos = slice[i-1].Pos
+			}
 		}
 		out = append(out, ChampSection{
 			ClassName: classLookup[cid].Name,
+			CountBest: cfg.ClassCountBest(classLookup[cid].Name),
 			Rows:      slice,
 		})
 	}
 	sort.Slice(out, func(i, j int) bool { return out[i].ClassName < out[j].ClassName })
 	return out
 }
+
+// changeRows describes the rallies of every time-bounded class membership.
+func changeRows(changes []database.ClassChange) []ClassChangeRow {
+	rows := make([]ClassChangeRow, len(changes))
+	for i, c := range changes {
+		var rallies string
+		switch {
+		case c.ToRally == 0:
+			rallies = fmt.Sprintf("from %d", c.FromRally)
+		case c.FromRally == 0:
+			rallies = fmt.Sprintf("until %d", c.ToRally)
+		default:
+			rallies = fmt.Sprintf("%d to %d", c.FromRally, c.ToRally)
+		}
+		rows[i] = ClassChangeRow{ClassName: c.ClassName, Member: c.Member, Rallies: rallies}
+	}
+	return rows
+}
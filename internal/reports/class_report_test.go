@@ -0,0 +1,65 @@
+package reports
+
+import (
+	"testing"
+
+	"github.com/MorganPeterson/octanepoints/internal/configuration"
+	"github.com/MorganPeterson/octanepoints/internal/database"
+)
+
+func TestBuildChampionshipTies(t *testing.T) {
+	rows := []ClassPointsRow{
+		{RallyID: 1, ClassID: 1, UserID: 4, UserName: "Dave", Points: 10},
+		{RallyID: 1, ClassID: 1, UserID: 2, UserName: "Bob", Points: 10},
+		{RallyID: 1, ClassID: 1, UserID: 1, UserName: "Alice", Points: 12},
+		{RallyID: 1, ClassID: 1, UserID: 3, UserName: "Carol", Points: 8},
+		{RallyID: 2, ClassID: 1, UserID: 3, UserName: "Carol", Points: 1},
+	}
+	lookup := map[int64]database.Class{1: {ID: 1, Name: "Gold"}}
+
+	// run it a few times, the drivers come out of a map
+	for range 10 {
+		got := buildChampionship(rows, lookup, &configuration.Config{})
+		if len(got) != 1 {
+			t.Fatalf("sections = %d, want 1", len(got))
+		}
+		want := []struct {
+			name string
+			pos  int64
+		}{{"Alice", 1}, {"Bob", 2}, {"Dave", 2}, {"Carol", 4}}
+		for i, w := range want {
+			r := got[0].Rows[i]
+			if r.UserName != w.name || r.Pos != w.pos {
+				t.Fatalf("row %d = %s P%d, want %s P%d", i, r.UserName, r.Pos, w.name, w.pos)
+			}
+		}
+	}
+}
+
+func TestBuildChampionshipClassCountBest(t *testing.T) {
+	rows := []ClassPointsRow{
+		{RallyID: 1, ClassID: 1, UserID: 1, UserName: "Alice", Points: 10},
+		{RallyID: 2, ClassID: 1, UserID: 1, UserName: "Alice", Points: 6},
+		{RallyID: 1, ClassID: 2, UserID: 2, UserName: "Bob", Points: 10},
+		{RallyID: 2, ClassID: 2, UserID: 2, UserName: "Bob", Points: 6},
+	}
+	lookup := map[int64]database.Class{1: {ID: 1, Name: "Gold"}, 2: {ID: 2, Name: "Silver"}}
+	one := int64(1)
+	cfg := &configuration.Config{
+		General: configuration.General{CountBest: 0},
+		Classes: []configuration.Class{{Name: "Gold", CountBest: &one}},
+	}
+
+	got := buildChampionship(rows, lookup, cfg)
+	if len(got) != 2 {
+		t.Fatalf("sections = %d, want 2", len(got))
+	}
+	gold, silver := got[0], got[1]
+	if gold.CountBest != 1 || gold.Rows[0].TotalPoints != 10 || gold.Rows[0].GrossPoints != 16 ||
+		len(gold.Rows[0].Dropped) != 1 || gold.Rows[0].Dropped[0] != (round{2, 6}) {
+		t.Errorf("Gold = %+v, want the best result of 1 counted", gold)
+	}
+	if silver.CountBest != 0 || silver.Rows[0].TotalPoints != 16 || len(silver.Rows[0].Dropped) != 0 {
+		t.Errorf("Silver = %+v, want every result counted", silver)
+	}
+}
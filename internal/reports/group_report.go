@@ -0,0 +1,286 @@
+package reports
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/MorganPeterson/octanepoints/internal/configuration"
+	"github.com/MorganPeterson/octanepoints/internal/database"
+)
+
+var groupReportTmpl = template.Must(
+	template.New("group_report.tmpl").
+		Funcs(sharedFuncMap).
+		ParseFS(tmplFS, "templates/group_report.tmpl"),
+)
+
+// A group championship is scored by groups of drivers, e.g. teams, with the
+// points their best drivers scored overall in every rally.
+
+// GroupScorer is a driver whose points counted for a group in a rally.
+type GroupScorer struct {
+	UserName string
+	Pos      int64
+	Points   int64
+}
+
+// GroupRallyRow is the result of a group in a single rally.
+type GroupRallyRow struct {
+	Pos      int64
+	Name     string
+	Points   int64
+	Starters int64 // drivers of the group who started the rally
+	Scorers  []GroupScorer
+}
+
+// GroupChampRow is the championship standing of a group.
+type GroupChampRow struct {
+	Pos     int64
+	Name    string
+	Points  int64
+	Rallies int64 // rallies the group had a starter in
+	Starts  int64 // rally starts of all the group's drivers
+	Drivers int64 // different drivers who started for the group
+
+	// Contributors are the drivers whose points counted for the group, with
+	// their season totals.
+	Contributors []GroupScorer
+}
+
+// GroupReportData is a group championship report handed to the templates.
+type GroupReportData struct {
+	Title        string // kind of group, e.g. "Team"
+	RallyID      int64
+	Rally        []GroupRallyRow
+	Championship []GroupChampRow
+}
+
+// groupRules say which groups a driver scores for in a rally and how many of
+// a group's drivers score.
+type groupRules struct {
+	groupsOf   func(r database.RallyOverall) []string
+	maxScorers func(group string) int64 // 0 lets every driver score
+}
+
+// scoreGroupRallies totals the points of the best drivers of every group per
+// rally. The result is ordered by rally and group standing.
+func scoreGroupRallies(scored []ScoreRecord, rules groupRules) map[int64][]GroupRallyRow {
+	type key struct {
+		RallyId int64
+		Group   string
+	}
+	members := map[key][]GroupScorer{}
+	for _, s := range scored {
+		for _, g := range rules.groupsOf(s.Raw) {
+			k := key{s.Raw.RallyId, g}
+			members[k] = append(members[k], GroupScorer{
+				UserName: s.Raw.UserName,
+				Pos:      s.Pos,
+				Points:   s.Points,
+			})
+		}
+	}
+
+	byRally := map[int64][]GroupRallyRow{}
+	for k, ms := range members {
+		sort.SliceStable(ms, func(i, j int) bool {
+			if ms[i].Points != ms[j].Points {
+				return ms[i].Points > ms[j].Points
+			}
+			return ms[i].Pos < ms[j].Pos
+		})
+
+		row := GroupRallyRow{Name: k.Group, Starters: int64(len(ms))}
+		for i, m := range ms {
+			if n := rules.maxScorers(k.Group); n > 0 && int64(i) >= n {
+				break
+			}
+			row.Points += m.Points
+			row.Scorers = append(row.Scorers, m)
+		}
+		byRally[k.RallyId] = append(byRally[k.RallyId], row)
+	}
+
+	for _, rows := range byRally {
+		sort.Slice(rows, func(i, j int) bool {
+			if rows[i].Points != rows[j].Points {
+				return rows[i].Points > rows[j].Points
+			}
+			return rows[i].Name < rows[j].Name
+		})
+		for i := range rows {
+			rows[i].Pos = sharedPos(i, func(j int) int64 { return rows[j].Points })
+		}
+	}
+	return byRally
+}
+
+// groupChampionship totals the rally results of every group.
+func groupChampionship(scored []ScoreRecord, rallies map[int64][]GroupRallyRow, rules groupRules) []GroupChampRow {
+	acc := map[string]*GroupChampRow{}
+	contrib := map[string]map[string]int64{}
+	for _, rows := range rallies {
+		for _, r := range rows {
+			if _, ok := acc[r.Name]; !ok {
+				acc[r.Name] = &GroupChampRow{Name: r.Name}
+				contrib[r.Name] = map[string]int64{}
+			}
+			acc[r.Name].Points += r.Points
+			acc[r.Name].Rallies++
+			acc[r.Name].Starts += r.Starters
+			for _, s := range r.Scorers {
+				contrib[r.Name][s.UserName] += s.Points
+			}
+		}
+	}
+
+	drivers := map[string]map[string]struct{}{}
+	for _, s := range scored {
+		for _, g := range rules.groupsOf(s.Raw) {
+			if drivers[g] == nil {
+				drivers[g] = map[string]struct{}{}
+			}
+			drivers[g][s.Raw.UserName] = struct{}{}
+		}
+	}
+
+	out := make([]GroupChampRow, 0, len(acc))
+	for name, r := range acc {
+		r.Drivers = int64(len(drivers[name]))
+		for user, pts := range contrib[name] {
+			r.Contributors = append(r.Contributors, GroupScorer{UserName: user, Points: pts})
+		}
+		sort.Slice(r.Contributors, func(i, j int) bool {
+			if r.Contributors[i].Points != r.Contributors[j].Points {
+				return r.Contributors[i].Points > r.Contributors[j].Points
+			}
+			return r.Contributors[i].UserName < r.Contributors[j].UserName
+		})
+		out = append(out, *r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Points != out[j].Points {
+			return out[i].Points > out[j].Points
+		}
+		return out[i].Name < out[j].Name
+	})
+	for i := range out {
+		out[i].Pos = sharedPos(i, func(j int) int64 { return out[j].Points })
+	}
+	return out
+}
+
+// sharedPos returns the 1-based position of index i in a list ordered by
+// points, where equal points share the better position.
+func sharedPos(i int, points func(j int) int64) int64 {
+	for i > 0 && points(i-1) == points(i) {
+		i--
+	}
+	return int64(i + 1)
+}
+
+// buildGroupReport scores a group championship for the rally and the season.
+func buildGroupReport(
+	title string, rally *database.Rally, rules groupRules,
+	store *database.Store, config *configuration.Config,
+) (GroupReportData, error) {
+	rallyScored, err := assignPointsOverall(rally, store, config)
+	if err != nil {
+		return GroupReportData{}, fmt.Errorf("assign rally points: %w", err)
+	}
+
+	allScored, err := scoreAllRallies(store, config)
+	if err != nil {
+		return GroupReportData{}, err
+	}
+
+	return GroupReportData{
+		Title:        title,
+		RallyID:      rally.RallyId,
+		Rally:        scoreGroupRallies(rallyScored, rules)[rally.RallyId],
+		Championship: groupChampionship(allScored, scoreGroupRallies(allScored, rules), rules),
+	}, nil
+}
+
+// exportGroupReport writes a group championship report in the configured
+// formats, named after the rally and fileName.
+func exportGroupReport(data GroupReportData, fileName string, config *configuration.Config) error {
+	switch config.Report.Format {
+	case "markdown":
+		return exportGroupMarkdown(data, fileName, config)
+	case "csv":
+		return exportGroupCSV(data, fileName, config)
+	case "both":
+		if err := exportGroupMarkdown(data, fileName, config); err != nil {
+			return err
+		}
+		return exportGroupCSV(data, fileName, config)
+	default:
+		return fmt.Errorf("unsupported report format: %s", config.Report.Format)
+	}
+}
+
+func exportGroupMarkdown(data GroupReportData, fileName string, config *configuration.Config) error {
+	var buf bytes.Buffer
+	if err := groupReportTmpl.Execute(&buf, data); err != nil {
+		return err
+	}
+
+	return writeMarkdown(fmt.Sprintf("%d_%s.%s", data.RallyID, fileName, "md"), buf, config)
+}
+
+func exportGroupCSV(data GroupReportData, fileName string, config *configuration.Config) error {
+	records := [][]string{}
+
+	records = append(records, []string{fmt.Sprintf("Rally %d - %s Results", data.RallyID, data.Title)})
+	records = append(records, []string{"Position", data.Title, "Points", "Starters", "Scorers"})
+	for _, row := range data.Rally {
+		records = append(records, []string{
+			fmt.Sprintf("%d", row.Pos),
+			row.Name,
+			fmt.Sprintf("%d", row.Points),
+			fmt.Sprintf("%d", row.Starters),
+			fmtScorers(row.Scorers),
+		})
+	}
+
+	records = append(records, []string{}) // Empty line
+	records = append(records, []string{fmt.Sprintf("%s Championship Standings", data.Title)})
+	records = append(records, []string{"Position", data.Title, "Total Points", "Rallies", "Starts", "Drivers", "Scored By"})
+	for _, row := range data.Championship {
+		records = append(records, []string{
+			fmt.Sprintf("%d", row.Pos),
+			row.Name,
+			fmt.Sprintf("%d", row.Points),
+			fmt.Sprintf("%d", row.Rallies),
+			fmt.Sprintf("%d", row.Starts),
+			fmt.Sprintf("%d", row.Drivers),
+			fmtContributors(row.Contributors),
+		})
+	}
+
+	return writeCSV(fmt.Sprintf("%d_%s.%s", data.RallyID, fileName, "csv"), records, config)
+}
+
+// fmtScorers lists the drivers who scored for a group, e.g.
+// "Alice (P1, 32), Bob (P4, 22)".
+func fmtScorers(scorers []GroupScorer) string {
+	parts := make([]string, len(scorers))
+	for i, s := range scorers {
+		parts[i] = fmt.Sprintf("%s (P%d, %d)", s.UserName, s.Pos, s.Points)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// fmtContributors lists the season points drivers scored for a group, e.g.
+// "Alice 60, Bob 22".
+func fmtContributors(scorers []GroupScorer) string {
+	parts := make([]string, len(scorers))
+	for i, s := range scorers {
+		parts[i] = fmt.Sprintf("%s %d", s.UserName, s.Points)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,41 @@
+package reports
+
+import (
+	"fmt"
+
+	"github.com/MorganPeterson/octanepoints/internal/configuration"
+	"github.com/MorganPeterson/octanepoints/internal/database"
+)
+
+// ExportManufacturerReport generates the manufacturer results for a single
+// rally and the manufacturer championship across all rallies. Drivers score
+// for the brand of the car they drove, and the overall points of the best
+// scoring.manufacturerScorers drivers of every brand count.
+func ExportManufacturerReport(rallyID int64, store *database.Store, cfg *configuration.Config) error {
+	rally, err := database.GetRally(store, rallyID)
+	if err != nil {
+		return fmt.Errorf("load rally: %w", err)
+	}
+
+	cars, err := database.GetCars(store)
+	if err != nil {
+		return fmt.Errorf("load cars: %w", err)
+	}
+
+	rules := groupRules{
+		groupsOf: func(r database.RallyOverall) []string {
+			if car, ok := cars[r.CarID]; ok && car.Brand != "" {
+				return []string{car.Brand}
+			}
+			return nil
+		},
+		maxScorers: func(string) int64 { return cfg.Scoring.ManufacturerScorers },
+	}
+
+	data, err := buildGroupReport("Manufacturer", rally, rules, store, cfg)
+	if err != nil {
+		return err
+	}
+
+	return exportGroupReport(data, cfg.Report.Manufacturers.SummaryFilename, cfg)
+}
@@ -0,0 +1,37 @@
+package reports
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MorganPeterson/octanepoints/internal/configuration"
+	"github.com/MorganPeterson/octanepoints/internal/database"
+)
+
+// ExportNationsReport generates the nations cup results for a single rally
+// and the nations cup standings across all rallies. Drivers score for their
+// nationality, and the overall points of the best scoring.nationScorers
+// drivers of every nation count.
+func ExportNationsReport(rallyID int64, store *database.Store, cfg *configuration.Config) error {
+	rally, err := database.GetRally(store, rallyID)
+	if err != nil {
+		return fmt.Errorf("load rally: %w", err)
+	}
+
+	rules := groupRules{
+		groupsOf: func(r database.RallyOverall) []string {
+			if nat := strings.TrimSpace(r.Nationality); nat != "" {
+				return []string{nat}
+			}
+			return nil
+		},
+		maxScorers: func(string) int64 { return cfg.Scoring.NationScorers },
+	}
+
+	data, err := buildGroupReport("Nation", rally, rules, store, cfg)
+	if err != nil {
+		return err
+	}
+
+	return exportGroupReport(data, cfg.Report.Nations.SummaryFilename, cfg)
+}
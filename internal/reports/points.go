@@ -0,0 +1,590 @@
+package reports
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MorganPeterson/octanepoints/internal/configuration"
+	"github.com/MorganPeterson/octanepoints/internal/database"
+)
+
+// rankEntry is one driver in a ranking that points are awarded for. Entries
+// are handed to rankAndScore ordered by time.
+type rankEntry struct {
+	Name       string
+	Time       time.Duration
+	BestStage  int64 // best stage position in the rally, 0 if unknown
+	Penalty    float64
+	SuperRally int64 // number of super rallied stages
+}
+
+// rankResult is the position and points awarded to the rankEntry at the same
+// index, together with a note explaining how a tie was settled.
+type rankResult struct {
+	Pos        int64
+	Points     int64
+	Note       string
+	Ineligible bool // not eligible under the eligibility rules
+}
+
+// stageBestKey identifies a driver in a rally for best stage lookups.
+type stageBestKey struct {
+	RallyId  int64
+	UserName string
+}
+
+// rankAndScore assigns positions and points from scheme to entries ordered by
+// time. Drivers with identical times are handled according to policy. Zero
+// times (no finishing time) never count as a tie.
+func rankAndScore(entries []rankEntry, scheme []int64, policy string) []rankResult {
+	results := make([]rankResult, len(entries))
+
+	for start := 0; start < len(entries); {
+		end := start + 1
+		if entries[start].Time > 0 {
+			for end < len(entries) && entries[end].Time == entries[start].Time {
+				end++
+			}
+		}
+
+		if end-start == 1 {
+			results[start] = rankResult{
+				Pos:    int64(start + 1),
+				Points: pointsFor(scheme, start),
+			}
+			start = end
+			continue
+		}
+
+		tied := make([]int, 0, end-start)
+		for i := start; i < end; i++ {
+			tied = append(tied, i)
+		}
+		switch policy {
+		case configuration.TieAverage:
+			var sum int64
+			for i := start; i < end; i++ {
+				sum += pointsFor(scheme, i)
+			}
+			pts := int64(math.Round(float64(sum) / float64(end-start)))
+			for _, idx := range tied {
+				results[idx] = rankResult{
+					Pos:    int64(start + 1),
+					Points: pts,
+					Note:   fmt.Sprintf("tied on time, points for P%d-P%d averaged", start+1, end),
+				}
+			}
+		case configuration.TieTiebreak:
+			breakTie(entries, results, tied, start, scheme)
+		default:
+			for _, idx := range tied {
+				results[idx] = rankResult{
+					Pos:    int64(start + 1),
+					Points: pointsFor(scheme, start),
+					Note:   fmt.Sprintf("tied on time, shares P%d", start+1),
+				}
+			}
+		}
+		start = end
+	}
+
+	return results
+}
+
+// eligibility says whether a driver scores points for their position.
+type eligibility struct {
+	Eligible bool
+	Factor   float64 // multiplier for the position points
+	Note     string
+}
+
+// checkEligibility applies the eligibility rules to a driver's result.
+func checkEligibility(e rankEntry, rules configuration.Eligibility) eligibility {
+	if e.Time <= 0 {
+		if *rules.RequireFinish {
+			return eligibility{Note: "did not finish"}
+		}
+		return eligibility{Eligible: true, Factor: 1, Note: "did not finish"}
+	}
+	if rules.MaxSuperRally > 0 && e.SuperRally > rules.MaxSuperRally {
+		return eligibility{Note: fmt.Sprintf("super rallied %d stage(s), over the limit of %d",
+			e.SuperRally, rules.MaxSuperRally)}
+	}
+	if e.SuperRally > 0 && *rules.SuperRallyFactor != 1 {
+		return eligibility{
+			Eligible: true,
+			Factor:   *rules.SuperRallyFactor,
+			Note:     fmt.Sprintf("super rallied %d stage(s), points x%g", e.SuperRally, *rules.SuperRallyFactor),
+		}
+	}
+	return eligibility{Eligible: true, Factor: 1}
+}
+
+// scoreEntries ranks entries ordered by time and awards points from scheme.
+// Finishers are ranked before drivers without a finishing time and only
+// drivers eligible under rules take up points positions. Drivers who are not
+// eligible are placed after them and score the participation points.
+func scoreEntries(
+	entries []rankEntry, scheme []int64, policy string, rules configuration.Eligibility,
+) []rankResult {
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return entries[order[i]].Time > 0 && entries[order[j]].Time <= 0
+	})
+
+	elig := make([]eligibility, len(entries))
+	var eligible, ineligible []int
+	for _, idx := range order {
+		elig[idx] = checkEligibility(entries[idx], rules)
+		if elig[idx].Eligible {
+			eligible = append(eligible, idx)
+		} else {
+			ineligible = append(ineligible, idx)
+		}
+	}
+
+	ranked := make([]rankEntry, len(eligible))
+	for i, idx := range eligible {
+		ranked[i] = entries[idx]
+	}
+	scored := rankAndScore(ranked, scheme, policy)
+
+	results := make([]rankResult, len(entries))
+	for i, idx := range eligible {
+		r := scored[i]
+		if f := elig[idx].Factor; f != 1 {
+			r.Points = int64(math.Round(float64(r.Points) * f))
+		}
+		r.Note = joinNotes(r.Note, elig[idx].Note)
+		results[idx] = r
+	}
+	for i, idx := range ineligible {
+		note := elig[idx].Note + ", no position points"
+		if rules.ParticipationPoints > 0 {
+			note = fmt.Sprintf("%s, %d participation points", elig[idx].Note, rules.ParticipationPoints)
+		}
+		results[idx] = rankResult{
+			Pos:        int64(len(eligible) + i + 1),
+			Points:     rules.ParticipationPoints,
+			Note:       note,
+			Ineligible: true,
+		}
+	}
+	return results
+}
+
+// breakTie orders the tied entries by best stage result and then by fewer
+// penalties. Entries that are still level share the better position.
+func breakTie(entries []rankEntry, results []rankResult, tied []int, start int, scheme []int64) {
+	sorted := append([]int(nil), tied...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return tiebreakLess(entries[sorted[i]], entries[sorted[j]])
+	})
+
+	for i, idx := range sorted {
+		pos := start + i
+		// still level with the entry before: share its position
+		if i > 0 && !tiebreakLess(entries[sorted[i-1]], entries[idx]) {
+			prev := results[sorted[i-1]]
+			results[idx] = rankResult{
+				Pos:    prev.Pos,
+				Points: prev.Points,
+				Note:   fmt.Sprintf("tied on time and tiebreak with %s, shares P%d", entries[sorted[i-1]].Name, prev.Pos),
+			}
+			continue
+		}
+
+		results[idx] = rankResult{
+			Pos:    int64(pos + 1),
+			Points: pointsFor(scheme, pos),
+		}
+		if i > 0 {
+			results[idx].Note = tiebreakNote("behind", entries[idx], entries[sorted[i-1]])
+		} else {
+			results[idx].Note = tiebreakNote("ahead of", entries[idx], entries[sorted[1]])
+		}
+	}
+}
+
+// tiebreakLess reports whether a wins the tiebreak against b.
+func tiebreakLess(a, b rankEntry) bool {
+	ab, bb := bestOrWorst(a.BestStage), bestOrWorst(b.BestStage)
+	if ab != bb {
+		return ab < bb
+	}
+	return a.Penalty < b.Penalty
+}
+
+// tiebreakNote explains why e was placed relative to other.
+func tiebreakNote(relation string, e, other rankEntry) string {
+	if bestOrWorst(e.BestStage) != bestOrWorst(other.BestStage) {
+		return fmt.Sprintf("tied on time, %s %s on best stage result (%s vs %s)",
+			relation, other.Name, stagePos(e.BestStage), stagePos(other.BestStage))
+	}
+	if e.Penalty != other.Penalty {
+		return fmt.Sprintf("tied on time, %s %s on penalties (%.0fs vs %.0fs)",
+			relation, other.Name, e.Penalty, other.Penalty)
+	}
+	return fmt.Sprintf("tied on time and tiebreak with %s", other.Name)
+}
+
+func bestOrWorst(pos int64) int64 {
+	if pos <= 0 {
+		return math.MaxInt64
+	}
+	return pos
+}
+
+func stagePos(pos int64) string {
+	if pos <= 0 {
+		return "none"
+	}
+	return fmt.Sprintf("P%d", pos)
+}
+
+// joinNotes joins the non-empty notes with "; ".
+func joinNotes(notes ...string) string {
+	var parts []string
+	for _, n := range notes {
+		if n != "" {
+			parts = append(parts, n)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// pointsFor returns the points for the 0-based place idx, or 0 past the end
+// of the scheme.
+func pointsFor(scheme []int64, idx int) int64 {
+	if idx < len(scheme) {
+		return scheme[idx]
+	}
+	return 0
+}
+
+// rallyScheme returns the points table for a rally: its own table if the
+// rally description has one, otherwise base, scaled by the rally's points
+// multiplier and rounded to whole points.
+func rallyScheme(base, override []int64, multiplier float64) []int64 {
+	scheme := base
+	if len(override) > 0 {
+		scheme = override
+	}
+	if multiplier <= 0 || multiplier == 1 {
+		return scheme
+	}
+
+	scaled := make([]int64, len(scheme))
+	for i, p := range scheme {
+		scaled[i] = scalePoints(p, multiplier)
+	}
+	return scaled
+}
+
+// scalePoints applies a rally's points multiplier to points, rounded to whole
+// points. A multiplier of 0 leaves them as they are.
+func scalePoints(points int64, multiplier float64) int64 {
+	if multiplier <= 0 || multiplier == 1 {
+		return points
+	}
+	return int64(math.Round(float64(points) * multiplier))
+}
+
+// overallSchemes returns the overall points table of every rally.
+func overallSchemes(rallies map[int64]database.Rally, config *configuration.Config) map[int64][]int64 {
+	m := make(map[int64][]int64, len(rallies))
+	for id, r := range rallies {
+		m[id] = rallyScheme(config.General.Points, r.Points, r.PointsMultiplier)
+	}
+	return m
+}
+
+// classSchemes returns the class points table of every rally.
+func classSchemes(rallies map[int64]database.Rally, config *configuration.Config) map[int64][]int64 {
+	m := make(map[int64][]int64, len(rallies))
+	for id, r := range rallies {
+		m[id] = rallyScheme(config.General.ClassPoints, r.ClassPoints, r.PointsMultiplier)
+	}
+	return m
+}
+
+// weightingNote describes how a rally's points differ from the season's
+// points tables, or returns "" if they don't. The multiplier also covers the
+// stage bonus points, which only the overall points include.
+func weightingNote(r database.Rally, class bool) string {
+	custom := len(r.Points) > 0
+	bonuses := " and stage bonuses"
+	if class {
+		custom = len(r.ClassPoints) > 0
+		bonuses = ""
+	}
+	weighted := r.PointsMultiplier > 0 && r.PointsMultiplier != 1
+
+	switch {
+	case custom && weighted:
+		return fmt.Sprintf("Custom points table for this rally, points%s multiplied by %g.", bonuses, r.PointsMultiplier)
+	case custom:
+		return "Custom points table for this rally."
+	case weighted:
+		return fmt.Sprintf("Points%s multiplied by %g for this rally.", bonuses, r.PointsMultiplier)
+	}
+	return ""
+}
+
+// loadStageBests fetches the best stage positions needed by the tiebreak
+// policy. For the other policies it returns nil without touching the database.
+func loadStageBests(
+	store *database.Store, rallyId *int64, config *configuration.Config,
+) (map[stageBestKey]int64, error) {
+	if config.General.TiePolicy != configuration.TieTiebreak {
+		return nil, nil
+	}
+
+	bests, err := database.GetStageBests(store, &database.QueryOpts{RallyId: rallyId})
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[stageBestKey]int64, len(bests))
+	for _, b := range bests {
+		m[stageBestKey{b.RallyId, b.UserName}] = b.BestStage
+	}
+	return m, nil
+}
+
+// stageBonus holds the bonus points a driver earned from stage results in a
+// single rally.
+type stageBonus struct {
+	PowerStagePos    int64 // position on the power stage, 0 if none scored
+	PowerStagePoints int64
+	StageWins        int64
+	StageWinPoints   int64
+}
+
+// Total returns all bonus points.
+func (b stageBonus) Total() int64 {
+	return b.PowerStagePoints + b.StageWinPoints
+}
+
+// Note explains where the bonus points came from.
+func (b stageBonus) Note() string {
+	var parts []string
+	if b.PowerStagePoints > 0 {
+		parts = append(parts, fmt.Sprintf("power stage P%d +%d", b.PowerStagePos, b.PowerStagePoints))
+	}
+	if b.StageWinPoints > 0 {
+		parts = append(parts, fmt.Sprintf("%d stage win(s) +%d", b.StageWins, b.StageWinPoints))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// loadStageBonuses calculates the stage bonus points of every driver, for a
+// single rally or, without a rally ID, for all rallies. Without any bonus
+// configured it returns nil without touching the database.
+func loadStageBonuses(
+	store *database.Store, rallyId *int64, config *configuration.Config,
+) (map[stageBestKey]stageBonus, error) {
+	if !config.Scoring.Enabled() {
+		return nil, nil
+	}
+
+	rallies, err := database.GetRallies(store)
+	if err != nil {
+		return nil, err
+	}
+
+	positions, err := database.GetStagePositions(store, &database.QueryOpts{RallyId: rallyId})
+	if err != nil {
+		return nil, err
+	}
+	return stageBonuses(positions, rallies, config), nil
+}
+
+// stageBonuses calculates the stage bonus points of every driver from their
+// stage positions, where equal times share a position. Bonuses are scaled by
+// each rally's points multiplier.
+func stageBonuses(
+	positions []database.StagePosition, rallies map[int64]database.Rally, config *configuration.Config,
+) map[stageBestKey]stageBonus {
+	// stage numbers per rally, to find the first and last stage
+	first := map[int64]int64{}
+	last := map[int64]int64{}
+	for _, p := range positions {
+		if f, ok := first[p.RallyId]; !ok || p.StageNum < f {
+			first[p.RallyId] = p.StageNum
+		}
+		if p.StageNum > last[p.RallyId] {
+			last[p.RallyId] = p.StageNum
+		}
+	}
+
+	powerStage := func(rallyId int64) int64 {
+		if ps := rallies[rallyId].PowerStage; ps > 0 {
+			return ps
+		}
+		switch config.Scoring.PowerStage.Stage {
+		case "":
+			return 0
+		case "first":
+			return first[rallyId]
+		case "last":
+			return last[rallyId]
+		default:
+			n, _ := strconv.ParseInt(config.Scoring.PowerStage.Stage, 10, 64)
+			return n
+		}
+	}
+
+	bonuses := map[stageBestKey]stageBonus{}
+	psPoints := config.Scoring.PowerStage.Points
+	for _, p := range positions {
+		k := stageBestKey{p.RallyId, p.UserName}
+		b := bonuses[k]
+
+		multiplier := rallies[p.RallyId].PointsMultiplier
+		if p.Position == 1 && config.Scoring.StageWinPoints > 0 {
+			b.StageWins++
+			b.StageWinPoints += scalePoints(config.Scoring.StageWinPoints, multiplier)
+		}
+
+		if p.StageNum == powerStage(p.RallyId) && p.Position <= int64(len(psPoints)) {
+			b.PowerStagePos = p.Position
+			b.PowerStagePoints = scalePoints(psPoints[p.Position-1], multiplier)
+		}
+
+		bonuses[k] = b
+	}
+
+	return bonuses
+}
+
+// scoreOverall awards overall points from scheme to the results of a single
+// rally, which must be ordered by time, applying the eligibility rules. Stage
+// bonus points are added on top of the points for the position, except for
+// drivers who aren't eligible.
+func scoreOverall(
+	recs []database.RallyOverall,
+	scheme []int64,
+	bests map[stageBestKey]int64,
+	bonuses map[stageBestKey]stageBonus,
+	config *configuration.Config,
+) []ScoreRecord {
+	entries := make([]rankEntry, len(recs))
+	for i, r := range recs {
+		entries[i] = rankEntry{
+			Name:       r.UserName,
+			Time:       r.Time3,
+			BestStage:  bests[stageBestKey{r.RallyId, r.UserName}],
+			Penalty:    r.Penalty,
+			SuperRally: r.SuperRally,
+		}
+	}
+
+	results := scoreEntries(entries, scheme, config.General.TiePolicy, config.Scoring.Eligibility)
+
+	scored := make([]ScoreRecord, len(recs))
+	for i, r := range recs {
+		var bonus stageBonus
+		if !results[i].Ineligible {
+			bonus = bonuses[stageBestKey{r.RallyId, r.UserName}]
+		}
+		scored[i] = ScoreRecord{
+			Raw:    r,
+			Pos:    results[i].Pos,
+			Points: results[i].Points + bonus.Total(),
+			Bonus:  bonus.Total(),
+			Note:   joinNotes(results[i].Note, bonus.Note()),
+		}
+	}
+
+	// a tiebreak may reorder drivers that were level on time
+	sort.SliceStable(scored, func(i, j int) bool { return scored[i].Pos < scored[j].Pos })
+	return scored
+}
+
+// scoreAllRallies awards overall points for every rally that counts towards
+// the championship.
+func scoreAllRallies(store *database.Store, config *configuration.Config) ([]ScoreRecord, error) {
+	recs, err := database.GetRallyOverall(store, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetching overall records: %w", err)
+	}
+
+	bests, err := loadStageBests(store, nil, config)
+	if err != nil {
+		return nil, err
+	}
+
+	bonuses, err := loadStageBonuses(store, nil, config)
+	if err != nil {
+		return nil, err
+	}
+
+	rallies, err := database.GetRallies(store)
+	if err != nil {
+		return nil, err
+	}
+	schemes := overallSchemes(rallies, config)
+
+	byRally := map[int64][]database.RallyOverall{}
+	var rallyIds []int64
+	for _, r := range recs {
+		if _, ok := byRally[r.RallyId]; !ok {
+			rallyIds = append(rallyIds, r.RallyId)
+		}
+		byRally[r.RallyId] = append(byRally[r.RallyId], r)
+	}
+	sort.Slice(rallyIds, func(i, j int) bool { return rallyIds[i] < rallyIds[j] })
+
+	var scored []ScoreRecord
+	for _, id := range rallyIds {
+		scored = append(scored, scoreOverall(byRally[id], schemes[id], bests, bonuses, config)...)
+	}
+	return scored, nil
+}
+
+// round is a single rally result counted towards a championship.
+type round struct {
+	RallyId int64
+	Points  int64
+}
+
+// countBest sums the best n rounds and returns the rounds that were dropped,
+// ordered by rally. Equal scores keep the earlier rally. With n <= 0 every
+// round counts.
+func countBest(rounds []round, n int64) (net int64, dropped []round) {
+	sorted := append([]round(nil), rounds...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Points != sorted[j].Points {
+			return sorted[i].Points > sorted[j].Points
+		}
+		return sorted[i].RallyId < sorted[j].RallyId
+	})
+
+	for i, r := range sorted {
+		if n > 0 && int64(i) >= n {
+			dropped = append(dropped, r)
+			continue
+		}
+		net += r.Points
+	}
+
+	sort.Slice(dropped, func(i, j int) bool { return dropped[i].RallyId < dropped[j].RallyId })
+	return net, dropped
+}
+
+// fmtDropped lists dropped rounds for the reports, e.g. "15234 (12), 15240 (0)".
+func fmtDropped(rounds []round) string {
+	parts := make([]string, len(rounds))
+	for i, r := range rounds {
+		parts[i] = fmt.Sprintf("%d (%d)", r.RallyId, r.Points)
+	}
+	return strings.Join(parts, ", ")
+}
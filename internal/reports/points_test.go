@@ -0,0 +1,295 @@
+package reports
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MorganPeterson/octanepoints/internal/configuration"
+	"github.com/MorganPeterson/octanepoints/internal/database"
+)
+
+// ranked is the position and points expected for an entry.
+type ranked struct {
+	pos    int64
+	points int64
+}
+
+func TestRankAndScore(t *testing.T) {
+	sec := func(s int) time.Duration { return time.Duration(s) * time.Second }
+	scheme := []int64{10, 8, 6, 4}
+
+	// B and C tie for P2
+	twoWay := []rankEntry{
+		{Name: "A", Time: sec(60)},
+		{Name: "B", Time: sec(65), BestStage: 3},
+		{Name: "C", Time: sec(65), BestStage: 1},
+		{Name: "D", Time: sec(70)},
+	}
+	// A, B and C tie for P1; B has the best stage result, C fewer penalties
+	// than A
+	threeWay := []rankEntry{
+		{Name: "A", Time: sec(60), BestStage: 2, Penalty: 10},
+		{Name: "B", Time: sec(60), BestStage: 1},
+		{Name: "C", Time: sec(60), BestStage: 2},
+		{Name: "D", Time: sec(70)},
+	}
+	// B and C tie for P2 and P3 of a table that ends at P2
+	straddling := []rankEntry{
+		{Name: "A", Time: sec(60)},
+		{Name: "B", Time: sec(65), BestStage: 1},
+		{Name: "C", Time: sec(65), BestStage: 2},
+	}
+	// nothing settles the tie
+	level := []rankEntry{
+		{Name: "A", Time: sec(60), BestStage: 1},
+		{Name: "B", Time: sec(60), BestStage: 1},
+		{Name: "C", Time: sec(70)},
+	}
+	// drivers without a finishing time never tie
+	dnf := []rankEntry{
+		{Name: "A", Time: sec(60)},
+		{Name: "B"},
+		{Name: "C"},
+	}
+
+	tests := []struct {
+		name    string
+		policy  string
+		scheme  []int64
+		entries []rankEntry
+		want    []ranked
+	}{
+		{"shared 2-way", configuration.TieShared, scheme, twoWay, []ranked{{1, 10}, {2, 8}, {2, 8}, {4, 4}}},
+		{"average 2-way", configuration.TieAverage, scheme, twoWay, []ranked{{1, 10}, {2, 7}, {2, 7}, {4, 4}}},
+		{"tiebreak 2-way", configuration.TieTiebreak, scheme, twoWay, []ranked{{1, 10}, {3, 6}, {2, 8}, {4, 4}}},
+		{"shared 3-way", configuration.TieShared, scheme, threeWay, []ranked{{1, 10}, {1, 10}, {1, 10}, {4, 4}}},
+		{"average 3-way", configuration.TieAverage, scheme, threeWay, []ranked{{1, 8}, {1, 8}, {1, 8}, {4, 4}}},
+		{"tiebreak 3-way", configuration.TieTiebreak, scheme, threeWay, []ranked{{3, 6}, {1, 10}, {2, 8}, {4, 4}}},
+		{"shared past the table", configuration.TieShared, []int64{10, 8}, straddling, []ranked{{1, 10}, {2, 8}, {2, 8}}},
+		{"average past the table", configuration.TieAverage, []int64{10, 8}, straddling, []ranked{{1, 10}, {2, 4}, {2, 4}}},
+		{"tiebreak past the table", configuration.TieTiebreak, []int64{10, 8}, straddling, []ranked{{1, 10}, {2, 8}, {3, 0}}},
+		{"average rounds half up", configuration.TieAverage, []int64{10, 7, 6}, twoWay[:3], []ranked{{1, 10}, {2, 7}, {2, 7}}},
+		{"average rounds to nearest", configuration.TieAverage, []int64{10, 8, 5, 4}, threeWay, []ranked{{1, 8}, {1, 8}, {1, 8}, {4, 4}}},
+		{"tiebreak still level", configuration.TieTiebreak, scheme, level, []ranked{{1, 10}, {1, 10}, {3, 6}}},
+		{"no finishing time", configuration.TieShared, scheme, dnf, []ranked{{1, 10}, {2, 8}, {3, 6}}},
+	}
+	for _, tt := range tests {
+		got := rankAndScore(tt.entries, tt.scheme, tt.policy)
+		for i, w := range tt.want {
+			if got[i].Pos != w.pos || got[i].Points != w.points {
+				t.Errorf("%s: %s = P%d %d points, want P%d %d points",
+					tt.name, tt.entries[i].Name, got[i].Pos, got[i].Points, w.pos, w.points)
+			}
+		}
+	}
+}
+
+func TestRankAndScoreNotes(t *testing.T) {
+	entries := []rankEntry{
+		{Name: "A", Time: time.Minute, BestStage: 2},
+		{Name: "B", Time: time.Minute, BestStage: 2, Penalty: 5},
+		{Name: "C", Time: time.Minute, BestStage: 1},
+	}
+	got := rankAndScore(entries, []int64{10, 8, 6}, configuration.TieTiebreak)
+
+	want := []string{
+		"tied on time, behind C on best stage result (P2 vs P1)",
+		"tied on time, behind A on penalties (5s vs 0s)",
+		"tied on time, ahead of A on best stage result (P1 vs P2)",
+	}
+	for i, w := range want {
+		if got[i].Note != w {
+			t.Errorf("%s note = %q, want %q", entries[i].Name, got[i].Note, w)
+		}
+	}
+
+	got = rankAndScore(entries, []int64{10, 8, 6}, configuration.TieAverage)
+	if !strings.Contains(got[0].Note, "P1-P3 averaged") {
+		t.Errorf("average note = %q", got[0].Note)
+	}
+}
+
+func TestScoreEntries(t *testing.T) {
+	requireFinish, factor := true, 0.5
+	rules := configuration.Eligibility{
+		RequireFinish:       &requireFinish,
+		MaxSuperRally:       2,
+		SuperRallyFactor:    &factor,
+		ParticipationPoints: 1,
+	}
+	// ordered by time as the database has them, no finishing time first
+	entries := []rankEntry{
+		{Name: "DNF"},
+		{Name: "A", Time: time.Minute},
+		{Name: "B", Time: time.Minute},
+		{Name: "SR", Time: 2 * time.Minute, SuperRally: 1},
+		{Name: "Over", Time: 3 * time.Minute, SuperRally: 3},
+		{Name: "C", Time: 4 * time.Minute},
+	}
+	got := scoreEntries(entries, []int64{10, 8, 6, 4}, configuration.TieShared, rules)
+
+	want := []ranked{{6, 1}, {1, 10}, {1, 10}, {3, 3}, {5, 1}, {4, 4}}
+	for i, w := range want {
+		if got[i].Pos != w.pos || got[i].Points != w.points {
+			t.Errorf("%s = P%d %d points, want P%d %d points",
+				entries[i].Name, got[i].Pos, got[i].Points, w.pos, w.points)
+		}
+	}
+	if !got[0].Ineligible || !got[4].Ineligible || got[3].Ineligible {
+		t.Errorf("ineligible = %v, %v, %v; want DNF and Over only",
+			got[0].Ineligible, got[4].Ineligible, got[3].Ineligible)
+	}
+}
+
+func TestCountBest(t *testing.T) {
+	rounds := []round{{1, 10}, {2, 4}, {3, 8}, {4, 4}}
+
+	tests := []struct {
+		name    string
+		n       int64
+		net     int64
+		dropped []round
+	}{
+		{"zero counts all", 0, 26, nil},
+		{"more than driven", 6, 26, nil},
+		{"as many as driven", 4, 26, nil},
+		{"best two", 2, 18, []round{{2, 4}, {4, 4}}},
+		// rounds 2 and 4 score the same, the later one is dropped
+		{"equal rounds", 3, 22, []round{{4, 4}}},
+	}
+	for _, tt := range tests {
+		net, dropped := countBest(rounds, tt.n)
+		if net != tt.net || len(dropped) != len(tt.dropped) {
+			t.Errorf("%s: countBest = %d, %v; want %d, %v", tt.name, net, dropped, tt.net, tt.dropped)
+			continue
+		}
+		for i := range dropped {
+			if dropped[i] != tt.dropped[i] {
+				t.Errorf("%s: dropped = %v, want %v", tt.name, dropped, tt.dropped)
+				break
+			}
+		}
+	}
+}
+
+func TestStageBonuses(t *testing.T) {
+	config := &configuration.Config{
+		Scoring: configuration.Scoring{
+			StageWinPoints: 2,
+			PowerStage:     configuration.PowerStage{Stage: "last", Points: []int64{5, 3, 1}},
+		},
+	}
+	rallies := map[int64]database.Rally{
+		1: {RallyId: 1},
+		2: {RallyId: 2, PowerStage: 7},         // not in the results
+		3: {RallyId: 3, PointsMultiplier: 1.5}, // rounds to whole points
+		4: {RallyId: 4, PointsMultiplier: 2},
+	}
+	positions := []database.StagePosition{
+		// A and B tie on the power stage, C is third
+		{RallyId: 1, StageNum: 1, UserName: "C", Position: 1},
+		{RallyId: 1, StageNum: 1, UserName: "A", Position: 2},
+		{RallyId: 1, StageNum: 2, UserName: "A", Position: 1},
+		{RallyId: 1, StageNum: 2, UserName: "B", Position: 1},
+		{RallyId: 1, StageNum: 2, UserName: "C", Position: 3},
+		{RallyId: 1, StageNum: 2, UserName: "D", Position: 4},
+		{RallyId: 2, StageNum: 1, UserName: "A", Position: 1},
+		{RallyId: 2, StageNum: 2, UserName: "A", Position: 1},
+		{RallyId: 3, StageNum: 1, UserName: "A", Position: 1},
+		{RallyId: 3, StageNum: 1, UserName: "B", Position: 2},
+		{RallyId: 4, StageNum: 1, UserName: "A", Position: 1},
+	}
+	got := stageBonuses(positions, rallies, config)
+
+	tests := []struct {
+		rallyId  int64
+		name     string
+		want     stageBonus
+		wantNote string
+	}{
+		{1, "A", stageBonus{PowerStagePos: 1, PowerStagePoints: 5, StageWins: 1, StageWinPoints: 2}, "power stage P1 +5, 1 stage win(s) +2"},
+		{1, "B", stageBonus{PowerStagePos: 1, PowerStagePoints: 5, StageWins: 1, StageWinPoints: 2}, "power stage P1 +5, 1 stage win(s) +2"},
+		{1, "C", stageBonus{PowerStagePos: 3, PowerStagePoints: 1, StageWins: 1, StageWinPoints: 2}, "power stage P3 +1, 1 stage win(s) +2"},
+		{1, "D", stageBonus{}, ""},
+		{2, "A", stageBonus{StageWins: 2, StageWinPoints: 4}, "2 stage win(s) +4"},
+		{3, "A", stageBonus{PowerStagePos: 1, PowerStagePoints: 8, StageWins: 1, StageWinPoints: 3}, "power stage P1 +8, 1 stage win(s) +3"},
+		{3, "B", stageBonus{PowerStagePos: 2, PowerStagePoints: 5}, "power stage P2 +5"},
+		{4, "A", stageBonus{PowerStagePos: 1, PowerStagePoints: 10, StageWins: 1, StageWinPoints: 4}, "power stage P1 +10, 1 stage win(s) +4"},
+	}
+	for _, tt := range tests {
+		b := got[stageBestKey{tt.rallyId, tt.name}]
+		if b != tt.want || b.Note() != tt.wantNote {
+			t.Errorf("rally %d %s = %+v %q, want %+v %q", tt.rallyId, tt.name, b, b.Note(), tt.want, tt.wantNote)
+		}
+	}
+}
+
+func TestStageBonusesNumberedStage(t *testing.T) {
+	config := &configuration.Config{
+		Scoring: configuration.Scoring{
+			PowerStage: configuration.PowerStage{Stage: "5", Points: []int64{3}},
+		},
+	}
+	rallies := map[int64]database.Rally{1: {RallyId: 1}, 2: {RallyId: 2}}
+	positions := []database.StagePosition{
+		// rally 1 has no stage 5
+		{RallyId: 1, StageNum: 1, UserName: "A", Position: 1},
+		{RallyId: 2, StageNum: 5, UserName: "A", Position: 1},
+	}
+	got := stageBonuses(positions, rallies, config)
+
+	if b := got[stageBestKey{1, "A"}]; b.Total() != 0 {
+		t.Errorf("rally 1 bonus = %+v, want none", b)
+	}
+	if b := got[stageBestKey{2, "A"}]; b.Total() != 3 {
+		t.Errorf("rally 2 bonus = %+v, want the power stage points", b)
+	}
+}
+
+func TestScoreOverallIneligibleBonus(t *testing.T) {
+	requireFinish, factor := true, 1.0
+	config := &configuration.Config{
+		General: configuration.General{TiePolicy: configuration.TieShared},
+		Scoring: configuration.Scoring{
+			Eligibility: configuration.Eligibility{
+				RequireFinish:    &requireFinish,
+				MaxSuperRally:    2,
+				SuperRallyFactor: &factor,
+			},
+		},
+	}
+	// X is fastest and on the power stage, but super rallied too often
+	recs := []database.RallyOverall{
+		{RallyId: 1, UserName: "X", Time3: time.Minute, SuperRally: 3},
+		{RallyId: 1, UserName: "Y", Time3: 2 * time.Minute},
+		{RallyId: 1, UserName: "Z", Time3: 3 * time.Minute},
+	}
+	bonuses := map[stageBestKey]stageBonus{
+		{1, "X"}: {PowerStagePos: 1, PowerStagePoints: 5, StageWins: 1, StageWinPoints: 2},
+		{1, "Y"}: {PowerStagePos: 2, PowerStagePoints: 3},
+	}
+	got := scoreOverall(recs, []int64{10, 8, 6}, nil, bonuses, config)
+
+	want := []struct {
+		name   string
+		pos    int64
+		points int64
+		bonus  int64
+	}{
+		// Y keeps the points for P2 on the power stage, nobody gets X's
+		{"Y", 1, 13, 3},
+		{"Z", 2, 8, 0},
+		{"X", 3, 0, 0},
+	}
+	for i, w := range want {
+		r := got[i]
+		if r.Raw.UserName != w.name || r.Pos != w.pos || r.Points != w.points || r.Bonus != w.bonus {
+			t.Errorf("row %d = %s P%d %d points (bonus %d), want %s P%d %d points (bonus %d)",
+				i, r.Raw.UserName, r.Pos, r.Points, r.Bonus, w.name, w.pos, w.points, w.bonus)
+		}
+	}
+	if strings.Contains(got[2].Note, "power stage") {
+		t.Errorf("ineligible note = %q, want no bonus", got[2].Note)
+	}
+}
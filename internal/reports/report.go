@@ -17,11 +17,14 @@ import (
 var tmplFS embed.FS
 
 var sharedFuncMap = template.FuncMap{
-	"add":      add,
-	"pad":      pad,
-	"padNum":   padNum,
-	"padFloat": padFloat,
-	"fmtDur":   parser.FmtDuration,
+	"add":          add,
+	"pad":          pad,
+	"padNum":       padNum,
+	"padFloat":     padFloat,
+	"fmtDur":       parser.FmtDuration,
+	"dropped":      fmtDropped,
+	"scorers":      fmtScorers,
+	"contributors": fmtContributors,
 }
 
 func add(a, b int) int { return a + b }
@@ -53,18 +56,7 @@ func padNum(n int64, w int) string {
 }
 
 func writeMarkdown(filename string, data bytes.Buffer, config *configuration.Config) error {
-	// get current directory
-	currentDir, err := os.Getwd()
-	if err != nil {
-		return fmt.Errorf("getting current directory: %w", err)
-	}
-	reportPath := filepath.Join(
-		currentDir,
-		config.General.Directory,
-		config.Report.Directory,
-		config.Report.MdDirectory,
-		filename,
-	)
+	reportPath := filepath.Join(config.ReportDir(config.Report.MdDirectory), filename)
 	f, err := os.Create(reportPath)
 	if err != nil {
 		return err
@@ -79,18 +71,7 @@ func writeMarkdown(filename string, data bytes.Buffer, config *configuration.Con
 }
 
 func writeCSV(filename string, records [][]string, config *configuration.Config) error {
-	// get current directory
-	currentDir, err := os.Getwd()
-	if err != nil {
-		return fmt.Errorf("getting current directory: %w", err)
-	}
-	reportPath := filepath.Join(
-		currentDir,
-		config.General.Directory,
-		config.Report.Directory,
-		config.Report.CsvDirectory,
-		filename,
-	)
+	reportPath := filepath.Join(config.ReportDir(config.Report.CsvDirectory), filename)
 	f, err := os.Create(reportPath)
 	if err != nil {
 		return err
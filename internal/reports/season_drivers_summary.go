@@ -15,32 +15,82 @@ var summaryTmpl = template.Must(
 		ParseFS(tmplFS, "templates/summary.tmpl"),
 )
 
+// SeasonSummaryRow is a driver's season summary with the rounds that didn't count.
+type SeasonSummaryRow struct {
+	database.DriverSummary
+	Dropped []round
+}
+
+// SummaryData is the season summary handed to the templates.
+type SummaryData struct {
+	Rows      []SeasonSummaryRow
+	CountBest int64 // only the best N results count, 0 counts all
+}
+
 func ExportDriverSummaries(store *database.Store, config *configuration.Config) error {
+	scored, err := scoreAllRallies(store, config)
+	if err != nil {
+		return err
+	}
+
+	// mark the rounds that do not count when only the best N results count
+	type key struct {
+		RallyId int64
+		UserId  int64
+	}
+	dropped := map[key]bool{}
+	droppedRounds := map[int64][]round{}
+	for _, s := range buildStandings(scored, config.General.CountBest) {
+		for _, r := range s.Dropped {
+			dropped[key{r.RallyId, s.UserId}] = true
+		}
+		droppedRounds[s.UserId] = s.Dropped
+	}
+
+	awarded := make([]database.AwardedPoints, len(scored))
+	for i, r := range scored {
+		awarded[i] = database.AwardedPoints{
+			RallyId:  r.Raw.RallyId,
+			UserId:   r.Raw.UserId,
+			UserName: r.Raw.UserName,
+			Points:   r.Points,
+			Dropped:  dropped[key{r.Raw.RallyId, r.Raw.UserId}],
+		}
+	}
+
 	var sums []database.DriverSummary
-	sums, err := database.GetSeasonSummary(store, config)
+	sums, err = database.GetSeasonSummary(store, awarded)
 	if err != nil {
 		return err
 	}
 
+	data := SummaryData{
+		Rows:      make([]SeasonSummaryRow, len(sums)),
+		CountBest: config.General.CountBest,
+	}
+	for i, s := range sums {
+		data.Rows[i] = SeasonSummaryRow{DriverSummary: s, Dropped: droppedRounds[s.UserId]}
+	}
+
 	// Export based on configured format
 	switch config.Report.Format {
 	case "markdown":
-		return exportDriverSummariesMarkdown(sums, config)
+		return exportDriverSummariesMarkdown(data, config)
 	case "csv":
-		return exportDriverSummariesCSV(sums, config)
+		return exportDriverSummariesCSV(data, config)
 	case "both":
-		if err := exportDriverSummariesMarkdown(sums, config); err != nil {
+		if err := exportDriverSummariesMarkdown(data, config); err != nil {
 			return err
 		}
-		return exportDriverSummariesCSV(sums, config)
+		return exportDriverSummariesCSV(data, config)
 	default:
 		return fmt.Errorf("unsupported report format: %s", config.Report.Format)
 	}
 }
 
-func exportDriverSummariesMarkdown(sums []database.DriverSummary, config *configuration.Config) error {
+func exportDriverSummariesMarkdown(data SummaryData, config *configuration.Config) error {
 	var buf bytes.Buffer
-	if err := summaryTmpl.Execute(&buf, sums); err != nil {
+	if err := summaryTmpl.Execute(&buf, data); err != nil {
 		return err
 	}
 
@@ -54,7 +104,7 @@ func exportDriverSummariesMarkdown(sums []database.DriverSummary, config *config
 	return nil
 }
 
-func exportDriverSummariesCSV(sums []database.DriverSummary, config *configuration.Config) error {
+func exportDriverSummariesCSV(data SummaryData, config *configuration.Config) error {
 	// Create CSV records
 	records := [][]string{}
 
@@ -70,10 +120,12 @@ func exportDriverSummariesCSV(sums []database.DriverSummary, config *configurati
 		"Average Position",
 		"Total Super Rallied Stages",
 		"Total Championship Points",
+		"Gross Championship Points",
+		"Dropped Rounds",
 	})
 
 	// Data rows
-	for _, summary := range sums {
+	for _, summary := range data.Rows {
 		records = append(records, []string{
 			summary.UserName,
 			summary.Nationality,
@@ -85,6 +137,8 @@ func exportDriverSummariesCSV(sums []database.DriverSummary, config *configurati
 			fmt.Sprintf("%.2f", summary.AveragePosition),
 			fmt.Sprintf("%d", summary.TotalSuperRalliedStages),
 			fmt.Sprintf("%d", summary.TotalChampionshipPoints),
+			fmt.Sprintf("%d", summary.GrossChampionshipPoints),
+			fmtDropped(summary.Dropped),
 		})
 	}
 
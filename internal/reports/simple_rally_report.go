@@ -14,18 +14,32 @@ import (
 type ReportData struct {
 	Rally        []ScoreRecord
 	Championship []SeasonsStandings
+	CountBest    int64  // only the best N results count, 0 counts all
+	Bonus        bool   // stage bonus points are awarded
+	Weighting    string // how the rally's points differ from the season's, if they do
 }
 
 // ScoreRecord holds the raw data and the assigned points for each record.
+// Pos is the position points were awarded for, which differs from the raw
+// position when drivers are tied. Points includes the stage Bonus points.
+// Note explains how a tie was settled and where bonus points came from.
 type ScoreRecord struct {
 	Raw    database.RallyOverall
+	Pos    int64
 	Points int64
+	Bonus  int64
+	Note   string
 }
 
+// SeasonsStandings is a driver's championship total. Points is the net total
+// of the counted rounds, Gross the total of every round.
 type SeasonsStandings struct {
+	Pos      int64 // shared by drivers level on points and gross points
 	UserId   int64
 	UserName string
 	Points   int64
+	Gross    int64
+	Dropped  []round
 }
 
 var reportTmpl = template.Must(
@@ -35,8 +49,13 @@ var reportTmpl = template.Must(
 )
 
 func ExportReport(rallyId int64, store *database.Store, config *configuration.Config) error {
+	rally, err := database.GetRally(store, rallyId)
+	if err != nil {
+		return fmt.Errorf("Failed to fetch rally: %v", err)
+	}
+
 	// Assign points to the overall results
-	scored, err := assignPointsOverall(rallyId, store, config)
+	scored, err := assignPointsOverall(rally, store, config)
 	if err != nil {
 		return fmt.Errorf("Failed to assign points: %v", err)
 	}
@@ -51,6 +70,9 @@ func ExportReport(rallyId int64, store *database.Store, config *configuration.Co
 	data := ReportData{
 		Rally:        scored,
 		Championship: standings,
+		CountBest:    config.General.CountBest,
+		Bonus:        config.Scoring.Enabled(),
+		Weighting:    weightingNote(*rally, false),
 	}
 
 	// Export based on configured format
@@ -90,18 +112,19 @@ func exportCSV(rallyId int64, data ReportData, config *configuration.Config) err
 	rallyResults := [][]string{}
 
 	// Rally results header
-	rallyResults = append(rallyResults, []string{"Rally Id", "Position", "Driver", "Car", "Time", "Points"})
+	rallyResults = append(rallyResults, []string{"Rally Id", "Position", "Driver", "Car", "Time", "Bonus", "Points", "Notes"})
 
 	// Rally results data
-	for i, record := range data.Rally {
-		position := fmt.Sprintf("%d", i+1)
+	for _, record := range data.Rally {
 		rallyResults = append(rallyResults, []string{
 			strconv.FormatInt(rallyId, 10),
-			position,
+			fmt.Sprintf("%d", record.Pos),
 			record.Raw.UserName,
 			record.Raw.Car,
 			record.Raw.Time3.String(),
+			fmt.Sprintf("%d", record.Bonus),
 			fmt.Sprintf("%d", record.Points),
+			record.Note,
 		})
 	}
 
@@ -112,16 +135,17 @@ func exportCSV(rallyId int64, data ReportData, config *configuration.Config) err
 
 	overallChampionship := [][]string{}
 	// Championship standings header
-	overallChampionship = append(overallChampionship, []string{"Rally Id", "Position", "Driver", "Total Points"})
+	overallChampionship = append(overallChampionship, []string{"Rally Id", "Position", "Driver", "Total Points", "Gross Points", "Dropped Rounds"})
 
 	// Championship standings data
-	for i, standing := range data.Championship {
-		position := fmt.Sprintf("%d", i+1)
+	for _, standing := range data.Championship {
 		overallChampionship = append(overallChampionship, []string{
 			fmt.Sprintf("%d", rallyId),
-			position,
+			fmt.Sprintf("%d", standing.Pos),
 			standing.UserName,
 			fmt.Sprintf("%d", standing.Points),
+			fmt.Sprintf("%d", standing.Gross),
+			fmtDropped(standing.Dropped),
 		})
 	}
 
@@ -131,65 +155,87 @@ func exportCSV(rallyId int64, data ReportData, config *configuration.Config) err
 	return writeCSV(fileName, overallChampionship, config)
 }
 
-// assignPointsOverall assigns points to each record based on the configured points system.
+// assignPointsOverall assigns points to each record based on the rally's
+// points table and the configured tie policy.
 func assignPointsOverall(
-	rallyId int64, store *database.Store, config *configuration.Config,
+	rally *database.Rally, store *database.Store, config *configuration.Config,
 ) ([]ScoreRecord, error) {
+	rallyId := rally.RallyId
+
 	// Fetch the overall results from the database
 	overallData, err := database.GetRallyOverall(store, &database.QueryOpts{RallyId: &rallyId})
 	if err != nil {
 		return nil, fmt.Errorf("Failed to fetch overall data: %w", err)
 	}
 
-	scored := make([]ScoreRecord, len(overallData))
-	for i, rec := range overallData {
-		pts := int64(0)
-		if i < len(config.General.Points) {
-			pts = config.General.Points[i]
-		}
-		scored[i] = ScoreRecord{
-			Raw:    rec,
-			Points: pts,
-		}
+	bests, err := loadStageBests(store, &rallyId, config)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch tiebreak data: %w", err)
+	}
+
+	bonuses, err := loadStageBonuses(store, &rallyId, config)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to calculate stage bonus points: %w", err)
 	}
-	return scored, nil
+
+	scheme := rallyScheme(config.General.Points, rally.Points, rally.PointsMultiplier)
+	return scoreOverall(overallData, scheme, bests, bonuses, config), nil
 }
 
 func fetchChampionshipPoints(
 	store *database.Store, config *configuration.Config,
 ) ([]SeasonsStandings, error) {
-	recs, err := database.GetRallyOverall(store, nil)
+	scored, err := scoreAllRallies(store, config)
 	if err != nil {
-		return nil, fmt.Errorf("fetching overall records: %w", err)
+		return nil, err
 	}
 
+	return buildStandings(scored, config.General.CountBest), nil
+}
+
+// buildStandings totals the scored rallies per driver, counting only the best
+// n results when n > 0.
+func buildStandings(scored []ScoreRecord, n int64) []SeasonsStandings {
 	standingsMap := make(map[int64]*SeasonsStandings)
-	for _, r := range recs {
-		pos, err := strconv.Atoi(r.Position)
-		if err != nil || pos < 1 || pos > len(config.General.Points) {
-			continue
-		}
-		pts := config.General.Points[pos-1]
-		if entry, ok := standingsMap[r.UserId]; ok {
-			entry.Points += int64(pts)
-		} else {
-			standingsMap[r.UserId] = &SeasonsStandings{
-				UserId:   r.UserId,
-				UserName: r.UserName,
-				Points:   int64(pts),
+	rounds := make(map[int64][]round)
+	for _, r := range scored {
+		if _, ok := standingsMap[r.Raw.UserId]; !ok {
+			standingsMap[r.Raw.UserId] = &SeasonsStandings{
+				UserId:   r.Raw.UserId,
+				UserName: r.Raw.UserName,
 			}
 		}
+		standingsMap[r.Raw.UserId].Gross += r.Points
+		rounds[r.Raw.UserId] = append(rounds[r.Raw.UserId], round{RallyId: r.Raw.RallyId, Points: r.Points})
 	}
 
 	standings := make([]SeasonsStandings, 0, len(standingsMap))
-	for _, e := range standingsMap {
+	for id, e := range standingsMap {
+		e.Points, e.Dropped = countBest(rounds[id], n)
 		standings = append(standings, *e)
 	}
 
-	// Sort standings by points in descending order
+	// Sort standings by points in descending order, gross points settle
+	// drivers level on the counted results and names order full ties, which
+	// share a position
 	sort.Slice(standings, func(i, j int) bool {
-		return standings[i].Points > standings[j].Points
+		if standings[i].Points != standings[j].Points {
+			return standings[i].Points > standings[j].Points
+		}
+		if standings[i].Gross != standings[j].Gross {
+			return standings[i].Gross > standings[j].Gross
+		}
+		if standings[i].UserName != standings[j].UserName {
+			return standings[i].UserName < standings[j].UserName
+		}
+		return standings[i].UserId < standings[j].UserId
 	})
+	for i := range standings {
+		standings[i].Pos = int64(i + 1)
+		if i > 0 && standings[i].Points == standings[i-1].Points && standings[i].Gross == standings[i-1].Gross {
+			standings[i].Pos = standings[i-1].Pos
+		}
+	}
 
-	return standings, nil
+	return standings
 }
@@ -0,0 +1,47 @@
+package reports
+
+import (
+	"fmt"
+
+	"github.com/MorganPeterson/octanepoints/internal/configuration"
+	"github.com/MorganPeterson/octanepoints/internal/database"
+)
+
+// ExportTeamReport generates the team results for a single rally and the
+// team championship across all rallies. Every team scores with the overall
+// points of its best maxScorers drivers in each rally.
+func ExportTeamReport(rallyID int64, store *database.Store, cfg *configuration.Config) error {
+	rally, err := database.GetRally(store, rallyID)
+	if err != nil {
+		return fmt.Errorf("load rally: %w", err)
+	}
+
+	members, err := database.GetTeamMembers(store)
+	if err != nil {
+		return fmt.Errorf("load teams: %w", err)
+	}
+
+	teamOf := map[string]string{}
+	maxScorers := map[string]int64{}
+	for _, m := range members {
+		teamOf[m.UserName] = m.TeamName
+		maxScorers[m.TeamName] = m.MaxScorers
+	}
+
+	rules := groupRules{
+		groupsOf: func(r database.RallyOverall) []string {
+			if t, ok := teamOf[r.UserName]; ok {
+				return []string{t}
+			}
+			return nil
+		},
+		maxScorers: func(team string) int64 { return maxScorers[team] },
+	}
+
+	data, err := buildGroupReport("Team", rally, rules, store, cfg)
+	if err != nil {
+		return err
+	}
+
+	return exportGroupReport(data, cfg.Report.Teams.SummaryFilename, cfg)
+}